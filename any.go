@@ -0,0 +1,50 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const lockAnyRetryInterval = 100 * time.Millisecond
+
+// LockAny gets the first lock it can from names and holds it until ctx is canceled. Use Handle.Name to find which
+// lock was obtained. Each name is tried in order without waiting. When none are available and the lock would wait,
+// as it does with "WithTimeout" or a ctx deadline, it keeps trying all of them until it either times out or obtains a
+// lock.
+func LockAny(ctx context.Context, db *sql.DB, names []string, options ...LockOption) (*Handle, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("could not obtain lock: no lock names")
+	}
+	opts := newLockOpts(options)
+	waits := opts.waits(ctx)
+	// try each name without waiting
+	options = append(options[:len(options):len(options)], WithNoWait())
+	var deadline <-chan time.Time
+	if opts.timeout > 0 {
+		timer := time.NewTimer(opts.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for {
+		var err error
+		for _, name := range names {
+			var h *Handle
+			h, err = Acquire(ctx, db, name, options...)
+			if err == nil {
+				return h, nil
+			}
+		}
+		if !waits {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("could not obtain lock: %w", ctx.Err())
+		case <-deadline:
+			return nil, err
+		case <-time.After(lockAnyRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package mysqllocker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestLockAny(t *testing.T) {
+	t.Run("gets the first free lock", func(t *testing.T) {
+		t.Parallel()
+		names := []string{t.Name() + "_0", t.Name() + "_1", t.Name() + "_2"}
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := Lock(ctx, db, names[0])
+		require.NoError(t, err)
+		h1, err := LockAny(ctx, db, names)
+		require.NoError(t, err)
+		require.Equal(t, names[1], h1.Name())
+		h2, err := LockAny(ctx, db, names)
+		require.NoError(t, err)
+		require.Equal(t, names[2], h2.Name())
+		_, err = LockAny(ctx, db, names)
+		require.Error(t, err)
+	})
+
+	t.Run("waits for a lock", func(t *testing.T) {
+		t.Parallel()
+		names := []string{t.Name() + "_0", t.Name() + "_1"}
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := Lock(ctx, db, names[0])
+		require.NoError(t, err)
+		holdCtx, holdCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer holdCancel()
+		_, err = Lock(holdCtx, db, names[1])
+		require.NoError(t, err)
+		h, err := LockAny(ctx, db, names, WithTimeout(time.Second))
+		require.NoError(t, err)
+		require.Equal(t, names[1], h.Name())
+	})
+
+	t.Run("waits until the ctx deadline", func(t *testing.T) {
+		t.Parallel()
+		names := []string{t.Name() + "_0"}
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		holdCtx, holdCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer holdCancel()
+		_, err := Lock(holdCtx, db, names[0])
+		require.NoError(t, err)
+		waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+		defer waitCancel()
+		h, err := LockAny(waitCtx, db, names)
+		require.NoError(t, err)
+		require.Equal(t, names[0], h.Name())
+
+		// but not with WithNoWait
+		_, err = LockAny(waitCtx, db, names, WithNoWait())
+		require.Error(t, err)
+	})
+}
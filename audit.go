@@ -0,0 +1,107 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultAuditTable is the table WithAudit writes to when no table is given.
+const DefaultAuditTable = "mysqllocker_audit"
+
+// defaultAuditTimeout is the deadline for writing an audit row when the lock has no WithReleaseTimeout.
+const defaultAuditTimeout = 5 * time.Second
+
+// WithAudit records lock events to table, or DefaultAuditTable when table is empty. table is used in queries as-is, so
+// it may be qualified with a database name. The table must already exist, such as from EnsureSchema, with at least
+// these columns:
+//
+//	CREATE TABLE mysqllocker_audit (
+//	  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  lock_name VARCHAR(64) NOT NULL,
+//	  event VARCHAR(16) NOT NULL,
+//	  holder VARCHAR(255) NOT NULL,
+//	  connection_id BIGINT UNSIGNED NOT NULL,
+//	  error TEXT NULL,
+//	  created_at DATETIME(6) NOT NULL,
+//	  KEY lock_name_created_at (lock_name, created_at)
+//	)
+//
+// Events are the EventType values: "acquire", "takeover" (acquired after waiting on another session), "renew_fail"
+// (the lock was lost) and "release". holder is the WithOwnerID value.
+// Auditing is best effort. Errors writing to the table are ignored and don't affect the lock. Each write has the
+// WithReleaseTimeout deadline, or five seconds when there is none.
+func WithAudit(table string) LockOption {
+	if table == "" {
+		table = DefaultAuditTable
+	}
+	return func(o *lockOpts) {
+		o.auditTable = table
+	}
+}
+
+// execer is satisfied by *sql.DB and *sql.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// audit writes an event to the audit table when auditing is enabled.
+func (h *Handle) audit(ex execer, event EventType, eventErr error) {
+	if h.opts.auditTable == "" {
+		return
+	}
+	var errMsg *string
+	if eventErr != nil {
+		msg := eventErr.Error()
+		errMsg = &msg
+	}
+	// use our own context so events are recorded after the calling function's context has been closed
+	timeout := h.opts.releaseTimeout
+	if timeout <= 0 {
+		timeout = defaultAuditTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	query := fmt.Sprintf(
+		"INSERT INTO %s (lock_name, event, holder, connection_id, error, created_at) VALUES (?, ?, ?, ?, ?, NOW(6))",
+		h.opts.auditTable,
+	)
+	_, _ = ex.ExecContext(ctx, query, h.lockName, string(event), h.opts.owner(), h.connectionID, errMsg) //nolint:errcheck
+}
+
+// WithOwnerID sets a human-readable identity for the lock holder, such as a service and instance name. It is
+// recorded in audit rows and in the @mysqllocker_owner variable on the lock's session, where other sessions can
+// read it from performance_schema.user_variables_by_thread. The default is the hostname and pid, like "host:1234".
+func WithOwnerID(ownerID string) LockOption {
+	return func(o *lockOpts) {
+		o.ownerID = ownerID
+	}
+}
+
+// owner returns the WithOwnerID value or defaultOwnerID.
+func (o *lockOpts) owner() string {
+	if o.ownerID != "" {
+		return o.ownerID
+	}
+	return defaultOwnerID()
+}
+
+var (
+	defaultOwnerOnce sync.Once
+	defaultOwner     string
+)
+
+// defaultOwnerID identifies this process by hostname and pid. It is worked out on the first call only.
+func defaultOwnerID() string {
+	defaultOwnerOnce.Do(func() {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		defaultOwner = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	})
+	return defaultOwner
+}
@@ -0,0 +1,54 @@
+package mysqllocker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithAudit(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.audit_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`
+CREATE TABLE %s (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  lock_name VARCHAR(64) NOT NULL,
+  event VARCHAR(16) NOT NULL,
+  holder VARCHAR(255) NOT NULL,
+  connection_id BIGINT UNSIGNED NOT NULL,
+  error TEXT NULL,
+  created_at DATETIME(6) NOT NULL
+)`, table))
+	require.NoError(t, err)
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs, err := Lock(lockCtx, db, lockName, WithAudit(table), WithOwnerID("audit-test"))
+	require.NoError(t, err)
+	cancel()
+	require.NoError(t, <-errs)
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT event, holder FROM %s WHERE lock_name = ? ORDER BY id`, table), lockName)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, rows.Close())
+	}()
+	var events []string
+	for rows.Next() {
+		var event, holder string
+		require.NoError(t, rows.Scan(&event, &holder))
+		require.Equal(t, "audit-test", holder)
+		events = append(events, event)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []string{"acquire", "release"}, events)
+}
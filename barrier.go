@@ -0,0 +1,208 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultBarrierTable is the table a Barrier uses when WithBarrierTable isn't set.
+const DefaultBarrierTable = "mysqllocker_barriers"
+
+const (
+	defaultBarrierTTL          = 30 * time.Second
+	defaultBarrierPollInterval = 100 * time.Millisecond
+)
+
+// Barrier makes n participants wait for each other. Each calls Arrive, and all of them return once the nth
+// arrives. The barrier then resets for the next n arrivals, so it can be used for each phase of a multi-node batch.
+//
+// Arrivals are rows in a table. The table must already exist, such as from EnsureSchema, with at least these columns:
+//
+//	CREATE TABLE mysqllocker_barriers (
+//	  name VARCHAR(64) NOT NULL,
+//	  generation BIGINT UNSIGNED NOT NULL,
+//	  participant VARCHAR(64) NOT NULL,
+//	  released TINYINT(1) NOT NULL,
+//	  expires_at DATETIME(6) NOT NULL,
+//	  PRIMARY KEY (name, generation, participant)
+//	)
+//
+// A waiting participant keeps its row alive. When a participant crashes, its row expires after the barrier's TTL
+// and it no longer counts toward n.
+type Barrier struct {
+	db           *sql.DB
+	name         string
+	n            int
+	table        string
+	ttl          time.Duration
+	pollInterval time.Duration
+}
+
+// BarrierOption is an optional value for NewBarrier
+type BarrierOption func(*Barrier)
+
+// WithBarrierTable sets the barrier's table. table is used in queries as-is, so it may be qualified with a database
+// name. Default is DefaultBarrierTable.
+func WithBarrierTable(table string) BarrierOption {
+	return func(b *Barrier) {
+		b.table = table
+	}
+}
+
+// WithBarrierTTL sets how long after its last sign of life a waiting participant stops counting toward n. Default
+// is 30 seconds.
+func WithBarrierTTL(ttl time.Duration) BarrierOption {
+	return func(b *Barrier) {
+		b.ttl = ttl
+	}
+}
+
+// WithBarrierPollInterval sets how often waiting participants check whether the barrier has been released and
+// renew their arrival. It must be shorter than the TTL. Default is 100 milliseconds.
+func WithBarrierPollInterval(pollInterval time.Duration) BarrierOption {
+	return func(b *Barrier) {
+		b.pollInterval = pollInterval
+	}
+}
+
+// NewBarrier returns a Barrier named name for n participants. Every participant must use the same name, n and table.
+func NewBarrier(db *sql.DB, name string, n int, options ...BarrierOption) *Barrier {
+	b := &Barrier{
+		db:           db,
+		name:         name,
+		n:            n,
+		table:        DefaultBarrierTable,
+		ttl:          defaultBarrierTTL,
+		pollInterval: defaultBarrierPollInterval,
+	}
+	for _, o := range options {
+		o(b)
+	}
+	return b
+}
+
+// LockName returns the name of the lock that serializes arrivals at the barrier.
+func (b *Barrier) LockName() string {
+	return Name("barrier", b.name).String()
+}
+
+// Arrive waits for the barrier's other participants. It returns nil once n participants have arrived, or ctx.Err()
+// when ctx is done first, in which case the arrival is withdrawn.
+func (b *Barrier) Arrive(ctx context.Context) error {
+	participant, err := newOwnerToken()
+	if err != nil {
+		return err
+	}
+	generation, released, err := b.arrive(ctx, participant)
+	if err != nil || released {
+		return err
+	}
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.withdraw(generation, participant)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		released, err = b.poll(ctx, generation, participant)
+		if err != nil || released {
+			return err
+		}
+	}
+}
+
+// arrive records the participant's arrival in the current generation and releases the generation if it is the
+// nth live arrival.
+func (b *Barrier) arrive(ctx context.Context, participant string) (generation int64, released bool, err error) {
+	h, err := Acquire(ctx, b.db, b.LockName(), WithTimeout(b.ttl))
+	if err != nil {
+		return 0, false, err
+	}
+	defer h.Release() //nolint:errcheck
+
+	var lastReleased bool
+	err = b.db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT generation, MAX(released) FROM %s WHERE name = ?
+GROUP BY generation ORDER BY generation DESC LIMIT 1`, b.table), b.name).Scan(&generation, &lastReleased)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if lastReleased {
+		generation++
+	}
+	_, err = b.db.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO %s (name, generation, participant, released, expires_at)
+VALUES (?, ?, ?, 0, NOW(6) + INTERVAL ? MICROSECOND)`, b.table),
+		b.name, generation, participant, b.ttl.Microseconds())
+	if err != nil {
+		return 0, false, err
+	}
+	var arrived int
+	err = b.db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT COUNT(*) FROM %s WHERE name = ? AND generation = ? AND expires_at > NOW(6)`, b.table),
+		b.name, generation).Scan(&arrived)
+	if err != nil || arrived < b.n {
+		return generation, false, err
+	}
+	_, err = b.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET released = 1 WHERE name = ? AND generation = ?`, b.table),
+		b.name, generation)
+	if err != nil {
+		return 0, false, err
+	}
+	// earlier generations' participants have all seen their release by now
+	_, err = b.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE name = ? AND generation < ?`, b.table),
+		b.name, generation)
+	return generation, true, err
+}
+
+// poll returns whether the participant's generation has been released and renews its arrival if it hasn't.
+func (b *Barrier) poll(ctx context.Context, generation int64, participant string) (bool, error) {
+	var released bool
+	err := b.db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT released FROM %s WHERE name = ? AND generation = ? AND participant = ?`, b.table),
+		b.name, generation, participant).Scan(&released)
+	// the row is only deleted after a later generation is released
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil || released {
+		return released, err
+	}
+	_, err = b.db.ExecContext(ctx, fmt.Sprintf(`
+UPDATE %s SET expires_at = NOW(6) + INTERVAL ? MICROSECOND
+WHERE name = ? AND generation = ? AND participant = ?`, b.table),
+		b.ttl.Microseconds(), b.name, generation, participant)
+	return false, err
+}
+
+// withdraw removes the participant's arrival. It is best effort because an expired arrival stops counting anyway.
+func (b *Barrier) withdraw(generation int64, participant string) {
+	_, _ = b.db.ExecContext(context.Background(), fmt.Sprintf(`
+DELETE FROM %s WHERE name = ? AND generation = ? AND participant = ? AND released = 0`, b.table),
+		b.name, generation, participant) //nolint:errcheck
+}
+
+// SchemaSQL returns the CREATE TABLE statement for the barrier's table with tableOptions, such as
+// "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", after it. It is for teams that manage DDL through their own migrations
+// instead of EnsureSchema.
+func (b *Barrier) SchemaSQL(tableOptions string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  name VARCHAR(64) NOT NULL,
+  generation BIGINT UNSIGNED NOT NULL,
+  participant VARCHAR(64) NOT NULL,
+  released TINYINT(1) NOT NULL,
+  expires_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (name, generation, participant)
+) %s`, b.table, tableOptions)
+}
+
+// EnsureSchema creates the barrier's table with the statement from SchemaSQL and DefaultTableOptions if it doesn't
+// exist.
+func (b *Barrier) EnsureSchema(ctx context.Context) error {
+	_, err := b.db.ExecContext(ctx, b.SchemaSQL(DefaultTableOptions))
+	return err
+}
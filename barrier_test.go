@@ -0,0 +1,61 @@
+package mysqllocker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestBarrier(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	const n = 3
+	table := "mysqllocker_test.barriers_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	newBarrier := func() *Barrier {
+		return NewBarrier(db, t.Name(), n, WithBarrierTable(table), WithBarrierPollInterval(10*time.Millisecond))
+	}
+	require.NoError(t, newBarrier().EnsureSchema(ctx))
+
+	// two phases through the same barrier
+	for phase := 0; phase < 2; phase++ {
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- newBarrier().Arrive(ctx)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+	}
+
+	// a participant that gives up doesn't count
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, newBarrier().Arrive(waitCtx))
+	waitCtx, cancel = context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, n-1)
+	for i := 0; i < n-1; i++ {
+		go func() {
+			errs <- newBarrier().Arrive(waitCtx)
+		}()
+	}
+	for i := 0; i < n-1; i++ {
+		require.Equal(t, context.DeadlineExceeded, <-errs)
+	}
+}
@@ -0,0 +1,46 @@
+package mysqllocker
+
+import "fmt"
+
+// PoolWarning is passed to the WithPoolBudget function when a Locker's held locks use too much of its db's
+// connection pool.
+type PoolWarning struct {
+	// HeldLocks is how many locks the Locker holds, each using a connection.
+	HeldLocks int
+	// MaxOpenConns is the db's limit on open connections.
+	MaxOpenConns int
+	// InUse is how many of the db's connections are in use, by locks or anything else.
+	InUse int
+}
+
+func (w PoolWarning) String() string {
+	return fmt.Sprintf("locks hold %d of %d allowed connections (%d in use)", w.HeldLocks, w.MaxOpenConns, w.InUse)
+}
+
+// WithPoolBudget calls warn when the Locker's held locks come to use fraction or more of its db's MaxOpenConns,
+// since lock connections that starve the application's queries are an easy mistake to make with a shared *sql.DB.
+// warn is called once each time the budget is exceeded and isn't called again until the held locks drop back under
+// it. It is never called when the db has no MaxOpenConns limit.
+func WithPoolBudget(fraction float64, warn func(warning PoolWarning)) LockerOption {
+	return func(l *Locker) {
+		l.budget = fraction
+		l.budgetWarn = warn
+	}
+}
+
+// checkBudget updates overBudget and returns a warning and true when the held locks just went over the
+// WithPoolBudget budget. The caller must hold heldMux.
+func (l *Locker) checkBudget() (PoolWarning, bool) {
+	if l.budgetWarn == nil {
+		return PoolWarning{}, false
+	}
+	stats := l.db.Stats()
+	over := stats.MaxOpenConnections > 0 && float64(len(l.held)) >= l.budget*float64(stats.MaxOpenConnections)
+	warn := over && !l.overBudget
+	l.overBudget = over
+	return PoolWarning{
+		HeldLocks:    len(l.held),
+		MaxOpenConns: stats.MaxOpenConnections,
+		InUse:        stats.InUse,
+	}, warn
+}
@@ -0,0 +1,117 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrUnsupported is matched by errors.Is for an *UnsupportedError.
+var ErrUnsupported = errors.New("unsupported by the server or the user's privileges")
+
+// UnsupportedError is the error for a feature the server or the user's privileges don't allow, such as reading
+// performance_schema as a user without SELECT on it. Use DetectCapabilities to check before relying on a feature.
+type UnsupportedError struct {
+	// Feature is what was attempted, such as "ListLocks".
+	Feature string
+	Err     error
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is %v: %v", e.Feature, ErrUnsupported, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *UnsupportedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrUnsupported.
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// unsupportedErrorNumbers are the mysql server error numbers for a missing privilege or table.
+var unsupportedErrorNumbers = map[uint16]bool{
+	1044: true, // access denied to database
+	1142: true, // command denied to user for table
+	1143: true, // command denied to user for column
+	1227: true, // access denied; you need the privilege for this operation
+	1146: true, // table doesn't exist
+}
+
+// unsupported wraps err in an *UnsupportedError for feature when it is a privilege or missing table error and
+// returns other errors as-is.
+func unsupported(feature string, err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && unsupportedErrorNumbers[mysqlErr.Number] {
+		return &UnsupportedError{Feature: feature, Err: err}
+	}
+	return err
+}
+
+// Capabilities are the optional server features available to a user. Features that need a missing capability
+// return an *UnsupportedError.
+type Capabilities struct {
+	// MetadataLocks is whether performance_schema.metadata_locks is readable and records named locks. CountWaiters,
+	// ListLocks, GetBlocker, WithBlockerDiagnostics and WithHierarchy need it.
+	MetadataLocks bool
+	// UserVariables is whether performance_schema.user_variables_by_thread is readable. GetBlocker needs it to find
+	// the holder's WithOwnerID value.
+	UserVariables bool
+	// Process is whether the user has the PROCESS privilege. Without it, GetLockOwner can only describe the user's own
+	// sessions.
+	Process bool
+}
+
+// DetectCapabilities checks which optional features db's server and user support. Check it at startup to degrade
+// gracefully instead of failing mid-operation.
+func DetectCapabilities(ctx context.Context, db *sql.DB) (*Capabilities, error) {
+	var caps Capabilities
+	var err error
+	caps.MetadataLocks, err = queryAllowed(ctx, db, `
+SELECT ENABLED = 'YES' FROM performance_schema.setup_instruments WHERE NAME = 'wait/lock/metadata/sql/mdl'`)
+	if err != nil {
+		return nil, err
+	}
+	if caps.MetadataLocks {
+		caps.MetadataLocks, err = queryAllowed(ctx, db, `SELECT COUNT(*) >= 0 FROM performance_schema.metadata_locks`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	caps.UserVariables, err = queryAllowed(ctx, db,
+		`SELECT COUNT(*) >= 0 FROM performance_schema.user_variables_by_thread`)
+	if err != nil {
+		return nil, err
+	}
+	caps.Process, err = queryAllowed(ctx, db, `
+SELECT COUNT(*) > 0 FROM information_schema.USER_PRIVILEGES
+WHERE PRIVILEGE_TYPE = 'PROCESS' AND GRANTEE = CONCAT(
+  "'", SUBSTRING_INDEX(CURRENT_USER(), '@', 1), "'@'", SUBSTRING_INDEX(CURRENT_USER(), '@', -1), "'"
+)`)
+	if err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// queryAllowed runs a query selecting one boolean. It returns false when the query fails for lack of a privilege or
+// table, or returns no rows.
+func queryAllowed(ctx context.Context, db *sql.DB, query string) (bool, error) {
+	var ok bool
+	err := db.QueryRowContext(ctx, query).Scan(&ok)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		if errors.Is(unsupported("", err), ErrUnsupported) {
+			return false, nil
+		}
+		return false, err
+	}
+	return ok, nil
+}
@@ -0,0 +1,36 @@
+package mysqllocker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestUnsupported(t *testing.T) {
+	denied := &mysql.MySQLError{Number: 1142, Message: "SELECT command denied"}
+	err := unsupported("ListLocks", denied)
+	require.True(t, errors.Is(err, ErrUnsupported))
+	var unsupportedErr *UnsupportedError
+	require.True(t, errors.As(err, &unsupportedErr))
+	require.Equal(t, "ListLocks", unsupportedErr.Feature)
+	require.True(t, errors.Is(err, denied))
+
+	other := &mysql.MySQLError{Number: 1064, Message: "syntax error"}
+	require.Equal(t, other, unsupported("ListLocks", other))
+	require.Nil(t, unsupported("ListLocks", nil))
+}
+
+func TestDetectCapabilities(t *testing.T) {
+	enableMDLInstrument(t)
+	caps, err := DetectCapabilities(context.Background(), testdb.DB(t))
+	require.NoError(t, err)
+	require.Equal(t, &Capabilities{
+		MetadataLocks: true,
+		UserVariables: true,
+		Process:       true,
+	}, caps)
+}
@@ -0,0 +1,208 @@
+// Command locksoak runs many concurrent lockers against a mysql server while breaking their connections, and checks
+// that mutual exclusion holds and that every lost lock is reported.
+//
+// Usage:
+//
+//	locksoak -dsn DSN [-workers 20] [-locks 5] [-duration 1m] [-kill-interval 2s]
+//	    [-restart-cmd "docker compose restart db" -restart-interval 30s]
+//
+// Workers repeatedly take a random lock, hold it for a random time and release it. Meanwhile, connections holding
+// locks are killed every -kill-interval, and -restart-cmd is run every -restart-interval to restart the server.
+//
+// When a worker gets a lock another worker still thinks it holds, the other worker's lock must have been lost, so
+// its Handle has to end with an error. A Handle that ends cleanly after being overlapped is a violation. locksoak
+// prints a summary when -duration passes and exits 1 when there were violations.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/willabides/mysqllocker"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	dsn := flag.String("dsn", os.Getenv("MYSQL_DSN"), "mysql data source name (default $MYSQL_DSN)")
+	workers := flag.Int("workers", 20, "number of concurrent lockers")
+	locks := flag.Int("locks", 5, "number of lock names to contend for")
+	duration := flag.Duration("duration", time.Minute, "how long to run")
+	hold := flag.Duration("hold", 500*time.Millisecond, "longest time to hold a lock")
+	pingInterval := flag.Duration("ping-interval", 100*time.Millisecond, "ping interval for held locks")
+	killInterval := flag.Duration("kill-interval", 2*time.Second, "how often to kill a lock's connection (0 to disable)")
+	restartCmd := flag.String("restart-cmd", "", "shell command that restarts the mysql server")
+	restartInterval := flag.Duration("restart-interval", 30*time.Second, "how often to run -restart-cmd")
+	flag.Parse()
+	if *dsn == "" {
+		log.Fatal("-dsn is required")
+	}
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close() //nolint:errcheck
+
+	s := &soak{
+		db:           db,
+		names:        make([]string, *locks),
+		hold:         *hold,
+		pingInterval: *pingInterval,
+		holders:      map[string]map[*holder]struct{}{},
+	}
+	for i := range s.names {
+		s.names[i] = fmt.Sprintf("locksoak/%d", i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	if *killInterval > 0 {
+		go every(ctx, *killInterval, s.kill)
+	}
+	if *restartCmd != "" {
+		go every(ctx, *restartInterval, func(ctx context.Context) {
+			s.restart(ctx, *restartCmd)
+		})
+	}
+	wg.Wait()
+
+	fmt.Printf("acquired: %d\nlost: %d\nkilled: %d\nrestarts: %d\nviolations: %d\n",
+		s.acquired, s.lost, s.killed, s.restarts, s.violations)
+	if s.violations > 0 {
+		os.Exit(1)
+	}
+}
+
+// holder is one worker's hold on a lock.
+type holder struct {
+	// overlapped is set when another worker got the lock during this hold. It is guarded by soak.mux.
+	overlapped bool
+}
+
+type soak struct {
+	db           *sql.DB
+	names        []string
+	hold         time.Duration
+	pingInterval time.Duration
+	mux          sync.Mutex
+	// holders are the workers that think they hold each lock
+	holders    map[string]map[*holder]struct{}
+	acquired   int64
+	lost       int64
+	killed     int64
+	restarts   int64
+	violations int64
+}
+
+// work takes and releases random locks until ctx is done.
+func (s *soak) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		name := s.names[rand.Intn(len(s.names))]
+		h, err := mysqllocker.Acquire(ctx, s.db, name,
+			mysqllocker.WithTimeout(s.hold),
+			mysqllocker.WithPingInterval(s.pingInterval),
+		)
+		if err != nil {
+			continue
+		}
+		atomic.AddInt64(&s.acquired, 1)
+		hd := s.start(name)
+		select {
+		case <-ctx.Done():
+		case <-h.Done():
+		case <-time.After(time.Duration(rand.Int63n(int64(s.hold)))):
+		}
+		// stop counting as a holder before releasing, so a worker getting the lock right after isn't an overlap
+		overlapped := s.stop(name, hd)
+		s.check(name, overlapped, h.Release())
+	}
+}
+
+// start records a new holder of name and marks any other holders as overlapped.
+func (s *soak) start(name string) *holder {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	hd := &holder{}
+	if s.holders[name] == nil {
+		s.holders[name] = map[*holder]struct{}{}
+	}
+	for other := range s.holders[name] {
+		other.overlapped = true
+	}
+	s.holders[name][hd] = struct{}{}
+	return hd
+}
+
+// stop removes hd from name's holders and returns whether another worker got the lock during the hold.
+func (s *soak) stop(name string, hd *holder) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.holders[name], hd)
+	return hd.overlapped
+}
+
+// check counts a hold that ended with err and checks that an overlapped hold reported a loss.
+func (s *soak) check(name string, overlapped bool, err error) {
+	if err != nil {
+		atomic.AddInt64(&s.lost, 1)
+		return
+	}
+	if overlapped {
+		atomic.AddInt64(&s.violations, 1)
+		log.Printf("violation: lock %q was held by another worker but its handle ended without an error", name)
+	}
+}
+
+// kill kills the connection holding a random lock.
+func (s *soak) kill(ctx context.Context) {
+	name := s.names[rand.Intn(len(s.names))]
+	var connectionID sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?)`, name).Scan(&connectionID)
+	if err != nil || !connectionID.Valid {
+		return
+	}
+	_, err = s.db.ExecContext(ctx, `KILL ?`, connectionID.Int64)
+	if err == nil {
+		atomic.AddInt64(&s.killed, 1)
+	}
+}
+
+// restart runs cmd to restart the server.
+func (s *soak) restart(ctx context.Context, cmd string) {
+	out, err := exec.CommandContext(ctx, "sh", "-c", cmd).CombinedOutput()
+	if err != nil {
+		log.Printf("restart failed: %v: %s", err, out)
+		return
+	}
+	atomic.AddInt64(&s.restarts, 1)
+}
+
+// every calls f every interval until ctx is done.
+func every(ctx context.Context, interval time.Duration, f func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f(ctx)
+		}
+	}
+}
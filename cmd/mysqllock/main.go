@@ -0,0 +1,115 @@
+// Command mysqllock inspects mysql named locks from the shell.
+//
+// Usage:
+//
+//	mysqllock wait -name NAME [-timeout DURATION]
+//	    Blocks until the lock is free without acquiring it. Exits 1 when timeout (default no timeout) passes first.
+//	mysqllock status -name NAME
+//	    Prints the session holding the lock or "free".
+//
+// Both subcommands take -dsn, which defaults to $MYSQL_DSN.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/willabides/mysqllocker"
+)
+
+const usage = `usage:
+  mysqllock wait -name NAME [-timeout DURATION]
+  mysqllock status -name NAME
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	var err error
+	switch os.Args[1] {
+	case "wait":
+		err = runWait(os.Args[2:])
+	case "status":
+		err = runStatus(os.Args[2:], os.Stdout)
+	default:
+		log.Fatal(usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// commonFlags adds the -dsn and -name flags to fs and returns a func that opens the db after fs is parsed.
+func commonFlags(fs *flag.FlagSet) (name *string, openDB func() (*sql.DB, error)) {
+	dsn := fs.String("dsn", os.Getenv("MYSQL_DSN"), "mysql data source name (default $MYSQL_DSN)")
+	name = fs.String("name", "", "lock name")
+	return name, func() (*sql.DB, error) {
+		if *dsn == "" {
+			return nil, fmt.Errorf("-dsn is required")
+		}
+		if *name == "" {
+			return nil, fmt.Errorf("-name is required")
+		}
+		return sql.Open("mysql", *dsn)
+	}
+}
+
+func runWait(args []string) error {
+	fs := flag.NewFlagSet("wait", flag.ExitOnError)
+	name, openDB := commonFlags(fs)
+	timeout := fs.Duration("timeout", 0, "give up after timeout (default no timeout)")
+	pollInterval := fs.Duration("poll-interval", time.Second, "how often to check the lock")
+	_ = fs.Parse(args) //nolint:errcheck // ExitOnError
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:errcheck
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	changes, err := mysqllocker.Observe(ctx, db, *name, mysqllocker.WithPollInterval(*pollInterval))
+	if err != nil {
+		return err
+	}
+	for change := range changes {
+		if change.Free() {
+			return nil
+		}
+	}
+	return fmt.Errorf("timed out waiting for lock %q", *name)
+}
+
+func runStatus(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	name, openDB := commonFlags(fs)
+	_ = fs.Parse(args) //nolint:errcheck // ExitOnError
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:errcheck
+	owner, err := mysqllocker.GetLockOwner(context.Background(), db, *name)
+	if err != nil {
+		return err
+	}
+	if owner == nil {
+		_, err = fmt.Fprintln(out, "free")
+		return err
+	}
+	_, err = fmt.Fprintf(out, "held by connection %d (%s@%s, in its current state for %s)\n",
+		owner.ConnectionID, owner.User, owner.Host, owner.CommandTime)
+	return err
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestRunStatus(t *testing.T) {
+	t.Run("requires a name", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runStatus([]string{"-dsn", "root:@tcp(127.0.0.1:1)/"}, &out)
+		require.EqualError(t, err, "-name is required")
+		require.Empty(t, out.String())
+	})
+
+	t.Run("free and held", func(t *testing.T) {
+		t.Parallel()
+		name := t.Name()
+		dsn := fmt.Sprintf("root:@tcp(%s)/", testdb.Addr(t))
+		var out bytes.Buffer
+		require.NoError(t, runStatus([]string{"-dsn", dsn, "-name", name}, &out))
+		require.Equal(t, "free\n", out.String())
+
+		h, err := mysqllocker.Acquire(context.Background(), testdb.DB(t), name)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, h.Release())
+		}()
+		out.Reset()
+		require.NoError(t, runStatus([]string{"-dsn", dsn, "-name", name}, &out))
+		require.Regexp(t, `^held by connection \d+ \(root@.+, in its current state for .+\)\n$`, out.String())
+	})
+}
@@ -0,0 +1,42 @@
+// Command mysqllockerd is an HTTP sidecar that holds mysql named locks on behalf of applications that can't
+// link the mysqllocker package.
+//
+// Endpoints:
+//
+//	POST /acquire?name=NAME&timeout=DURATION
+//	    Waits up to timeout (default 0) for the lock and responds with {"name": NAME, "token": TOKEN}.
+//	    Responds with 409 Conflict when the lock could not be obtained.
+//	POST /heartbeat?token=TOKEN
+//	    Keeps the lock. A lock is released when it hasn't had a heartbeat within -ttl.
+//	    Responds with 404 Not Found when the lock is no longer held.
+//	POST /release?token=TOKEN
+//	    Releases the lock.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	dsn := flag.String("dsn", os.Getenv("MYSQL_DSN"), "mysql data source name (default $MYSQL_DSN)")
+	ttl := flag.Duration("ttl", 30*time.Second, "release locks that haven't had a heartbeat within ttl")
+	pingInterval := flag.Duration("ping-interval", 10*time.Second, "interval for pinging lock connections")
+	flag.Parse()
+	if *dsn == "" {
+		log.Fatal("-dsn is required")
+	}
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := newServer(db, *ttl, *pingInterval)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
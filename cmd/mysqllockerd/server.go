@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+type lease struct {
+	handle *mysqllocker.Handle
+	cancel context.CancelFunc
+	timer  *time.Timer
+}
+
+type server struct {
+	db           *sql.DB
+	ttl          time.Duration
+	pingInterval time.Duration
+	mux          *http.ServeMux
+
+	leasesMux sync.Mutex
+	leases    map[string]*lease
+}
+
+func newServer(db *sql.DB, ttl, pingInterval time.Duration) *server {
+	s := &server{
+		db:           db,
+		ttl:          ttl,
+		pingInterval: pingInterval,
+		mux:          http.NewServeMux(),
+		leases:       map[string]*lease{},
+	}
+	s.mux.HandleFunc("/acquire", s.post(s.acquire))
+	s.mux.HandleFunc("/heartbeat", s.post(s.heartbeat))
+	s.mux.HandleFunc("/release", s.post(s.release))
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *server) post(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *server) acquire(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	var timeout time.Duration
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		var err error
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			http.Error(w, "invalid timeout", http.StatusBadRequest)
+			return
+		}
+	}
+	token, err := newToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the lock must outlive the request, so only use the request's context for waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-r.Context().Done():
+			cancel()
+		case <-stop:
+		}
+	}()
+	h, err := mysqllocker.Acquire(ctx, s.db, name,
+		mysqllocker.WithTimeout(timeout),
+		mysqllocker.WithPingInterval(s.pingInterval),
+	)
+	// stop watching before responding because the request's context is canceled when the handler returns
+	close(stop)
+	<-watcherDone
+	if err == nil && ctx.Err() != nil {
+		// the request ended just as the lock was granted, so there is nobody to give it to
+		_ = h.Release() //nolint:errcheck
+		err = ctx.Err()
+	}
+	if err != nil {
+		cancel()
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	l := &lease{
+		handle: h,
+		cancel: cancel,
+		timer:  time.AfterFunc(s.ttl, cancel),
+	}
+	s.leasesMux.Lock()
+	s.leases[token] = l
+	s.leasesMux.Unlock()
+	go func() {
+		<-h.Done()
+		l.timer.Stop()
+		s.leasesMux.Lock()
+		delete(s.leases, token)
+		s.leasesMux.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+		"name":  name,
+		"token": token,
+	})
+}
+
+func (s *server) heartbeat(w http.ResponseWriter, r *http.Request) {
+	l := s.lease(r)
+	if l == nil {
+		http.NotFound(w, r)
+		return
+	}
+	l.timer.Reset(s.ttl)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) release(w http.ResponseWriter, r *http.Request) {
+	l := s.lease(r)
+	if l == nil {
+		http.NotFound(w, r)
+		return
+	}
+	l.cancel()
+	<-l.handle.Done()
+	if err := l.handle.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) lease(r *http.Request) *lease {
+	s.leasesMux.Lock()
+	defer s.leasesMux.Unlock()
+	return s.leases[r.URL.Query().Get("token")]
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+// do sends a request to srv and returns the response recorder.
+func do(srv http.Handler, method, path string, query url.Values) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(method, path+"?"+query.Encode(), nil))
+	return rec
+}
+
+// acquireToken acquires name from srv and returns the lease token.
+func acquireToken(t *testing.T, srv http.Handler, name string) string {
+	t.Helper()
+	rec := do(srv, http.MethodPost, "/acquire", url.Values{"name": {name}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, name, body["name"])
+	require.NotEmpty(t, body["token"])
+	return body["token"]
+}
+
+func TestServerRequests(t *testing.T) {
+	srv := newServer(nil, time.Minute, time.Second)
+	rec := do(srv, http.MethodGet, "/acquire", url.Values{"name": {"x"}})
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	rec = do(srv, http.MethodPost, "/acquire", url.Values{})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(srv, http.MethodPost, "/acquire", url.Values{"name": {"x"}, "timeout": {"soon"}})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(srv, http.MethodPost, "/heartbeat", url.Values{"token": {"unknown"}})
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = do(srv, http.MethodPost, "/release", url.Values{"token": {"unknown"}})
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestServer(t *testing.T) {
+	t.Run("acquire and release", func(t *testing.T) {
+		t.Parallel()
+		name := t.Name()
+		srv := newServer(testdb.DB(t), time.Minute, 10*time.Millisecond)
+		token := acquireToken(t, srv, name)
+
+		rec := do(srv, http.MethodPost, "/acquire", url.Values{"name": {name}, "timeout": {"10ms"}})
+		require.Equal(t, http.StatusConflict, rec.Code)
+		rec = do(srv, http.MethodPost, "/heartbeat", url.Values{"token": {token}})
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		rec = do(srv, http.MethodPost, "/release", url.Values{"token": {token}})
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		require.Eventually(t, func() bool {
+			return do(srv, http.MethodPost, "/heartbeat", url.Values{"token": {token}}).Code == http.StatusNotFound
+		}, time.Second, 10*time.Millisecond)
+
+		token = acquireToken(t, srv, name)
+		rec = do(srv, http.MethodPost, "/release", url.Values{"token": {token}})
+		require.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("keeps the lease after the response", func(t *testing.T) {
+		t.Parallel()
+		name := t.Name()
+		db := testdb.DB(t)
+		ts := httptest.NewServer(newServer(db, time.Minute, 10*time.Millisecond))
+		defer ts.Close()
+		post := func(path string, query url.Values) *http.Response {
+			t.Helper()
+			resp, err := http.Post(ts.URL+path+"?"+query.Encode(), "", nil)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				require.NoError(t, resp.Body.Close())
+			})
+			return resp
+		}
+		// the request's context is canceled once each response is written, so check more than once
+		for i := 0; i < 10; i++ {
+			resp := post("/acquire", url.Values{"name": {name}})
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			time.Sleep(20 * time.Millisecond)
+			var held bool
+			require.NoError(t, db.QueryRow(`SELECT IS_USED_LOCK(?) IS NOT NULL`, name).Scan(&held))
+			require.True(t, held)
+			resp = post("/heartbeat", url.Values{"token": {body["token"]}})
+			require.Equal(t, http.StatusNoContent, resp.StatusCode)
+			resp = post("/release", url.Values{"token": {body["token"]}})
+			require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		}
+	})
+
+	t.Run("releases without a heartbeat", func(t *testing.T) {
+		t.Parallel()
+		name := t.Name()
+		srv := newServer(testdb.DB(t), 50*time.Millisecond, 10*time.Millisecond)
+		token := acquireToken(t, srv, name)
+		require.Eventually(t, func() bool {
+			return do(srv, http.MethodPost, "/heartbeat", url.Values{"token": {token}}).Code == http.StatusNotFound
+		}, time.Second, 10*time.Millisecond)
+		token = acquireToken(t, srv, name)
+		rec := do(srv, http.MethodPost, "/release", url.Values{"token": {token}})
+		require.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("lost lock", func(t *testing.T) {
+		t.Parallel()
+		name := t.Name()
+		db := testdb.DB(t)
+		srv := newServer(db, time.Minute, 10*time.Millisecond)
+		token := acquireToken(t, srv, name)
+		var connectionID int64
+		require.NoError(t, db.QueryRow(`SELECT IS_USED_LOCK(?)`, name).Scan(&connectionID))
+		_, err := db.ExecContext(context.Background(), `KILL ?`, connectionID)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return do(srv, http.MethodPost, "/heartbeat", url.Values{"token": {token}}).Code == http.StatusNotFound
+		}, 5*time.Second, 10*time.Millisecond)
+		token = acquireToken(t, srv, name)
+		rec := do(srv, http.MethodPost, "/release", url.Values{"token": {token}})
+		require.Equal(t, http.StatusNoContent, rec.Code)
+	})
+}
@@ -0,0 +1,59 @@
+package mysqllocker
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// WithQueryComments prepends a sqlcommenter-style comment like
+// /*application='billing',lock='nightly',owner='host%3A1234'*/ to the statements that get, check and release the
+// lock, so DBAs can tell which service owns a lock session from the processlist or slow log. owner is the
+// WithOwnerID value. tags is called with each statement's context for additional tags, such as a W3C traceparent,
+// and may be nil.
+func WithQueryComments(application string, tags func(ctx context.Context) map[string]string) LockOption {
+	return func(o *lockOpts) {
+		o.commentApplication = application
+		o.commentTags = tags
+		o.queryComments = true
+	}
+}
+
+// commented returns query with the WithQueryComments comment for lockName prepended.
+func (o *lockOpts) commented(ctx context.Context, lockName, query string) string {
+	if o == nil || !o.queryComments {
+		return query
+	}
+	tags := map[string]string{}
+	if o.commentTags != nil {
+		for k, v := range o.commentTags(ctx) {
+			tags[k] = v
+		}
+	}
+	if o.commentApplication != "" {
+		tags["application"] = o.commentApplication
+	}
+	tags["lock"] = lockName
+	tags["owner"] = o.owner()
+	return sqlComment(tags) + " " + query
+}
+
+// sqlComment formats tags as a sqlcommenter comment with keys sorted and keys and values url encoded.
+func sqlComment(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = commentEscape(k) + "='" + commentEscape(tags[k]) + "'"
+	}
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
+
+// commentEscape url encodes s with spaces as %20. The result can't contain quotes or end the comment.
+func commentEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
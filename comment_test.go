@@ -0,0 +1,24 @@
+package mysqllocker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithQueryComments(t *testing.T) {
+	ctx := context.Background()
+	opts := newLockOpts(nil)
+	require.Equal(t, `DO RELEASE_LOCK(?)`, opts.commented(ctx, "foo", `DO RELEASE_LOCK(?)`))
+
+	opts = newLockOpts([]LockOption{
+		WithOwnerID("host:1234"),
+		WithQueryComments("billing app", func(ctx context.Context) map[string]string {
+			return map[string]string{"traceparent": "00-abc-def-01", "evil": "*/ DROP TABLE x; /*'"}
+		}),
+	})
+	want := `/*application='billing%20app',evil='%2A%2F%20DROP%20TABLE%20x%3B%20%2F%2A%27',lock='tenant%2F42',` +
+		`owner='host%3A1234',traceparent='00-abc-def-01'*/ DO RELEASE_LOCK(?)`
+	require.Equal(t, want, opts.commented(ctx, "tenant/42", `DO RELEASE_LOCK(?)`))
+}
@@ -0,0 +1,42 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// AcquireConnector is like Acquire but opens its own *sql.DB from c for the lock session instead of sharing the
+// application's pool. The DB is limited to a single connection and is closed when the lock is released.
+//
+// Any connector will work, including ones from drivers wrapped for tracing or hooks (otelsql, sqlhooks). Like
+// Acquire, the lock is checked at each ping interval with a query on its connection that verifies the session still
+// holds it, or with a ping between WithCheckEvery checks.
+//
+// The lock holds the DB's only connection while it is held, so options that query while the lock is held, such as
+// WithPriority, WithPreemption, WithAudit and WithRenewalSLO, run those queries on the lock's connection instead of
+// the DB. Anything that needed a second connection from the DB would wait until the lock was released.
+func AcquireConnector(ctx context.Context, c driver.Connector, lockName string, options ...LockOption) (*Handle, error) {
+	db := sql.OpenDB(c)
+	db.SetMaxOpenConns(1)
+	opts := newLockOpts(options)
+	h, err := acquire(ctx, db, lockName, opts)
+	if err != nil {
+		_ = db.Close() //nolint:errcheck
+		return nil, err
+	}
+	h.ownedDB = db
+	h.start(ctx)
+	return h, nil
+}
+
+// NewLockerConnector returns a Locker with its own connection pool opened from c, so locks don't compete with
+// application queries for connections in a shared *sql.DB. The pool doesn't keep idle connections, so it only holds
+// a connection for each held lock. Use Locker.PoolStats to monitor it and Locker.Close to close it.
+func NewLockerConnector(c driver.Connector, options ...LockerOption) *Locker {
+	db := sql.OpenDB(c)
+	db.SetMaxIdleConns(0)
+	l := NewLocker(db, options...)
+	l.ownsDB = true
+	return l
+}
@@ -0,0 +1,64 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+type countingConnector struct {
+	driver.Connector
+	connects int64
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	atomic.AddInt64(&c.connects, 1)
+	return c.Connector.Connect(ctx)
+}
+
+func TestAcquireConnector(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	cfg, err := mysql.ParseDSN(fmt.Sprintf("root:@tcp(%s)/", testdb.Addr(t)))
+	require.NoError(t, err)
+	mysqlConnector, err := mysql.NewConnector(cfg)
+	require.NoError(t, err)
+	connector := &countingConnector{Connector: mysqlConnector}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := AcquireConnector(ctx, connector, lockName)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), atomic.LoadInt64(&connector.connects))
+	cancel()
+	<-h.Done()
+	require.NoError(t, h.Err())
+	require.Error(t, h.ownedDB.PingContext(context.Background()), "db should be closed")
+}
+
+func TestNewLockerConnector(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	cfg, err := mysql.ParseDSN(fmt.Sprintf("root:@tcp(%s)/", testdb.Addr(t)))
+	require.NoError(t, err)
+	connector, err := mysql.NewConnector(cfg)
+	require.NoError(t, err)
+	locker := NewLockerConnector(connector)
+	defer func() {
+		require.NoError(t, locker.Close())
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := locker.Acquire(ctx, lockName)
+	require.NoError(t, err)
+	require.Equal(t, 1, locker.PoolStats().InUse)
+	cancel()
+	<-h.Done()
+	require.NoError(t, h.Err())
+	require.Equal(t, 0, locker.PoolStats().OpenConnections)
+}
@@ -0,0 +1,70 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRecentlyHeld is returned by locks with WithContestedWindow when the lock was found held by another session
+// within the window, without asking the server again.
+var ErrRecentlyHeld = errors.New("could not obtain lock: lock was recently held by another session")
+
+// WithContestedWindow makes a lock that is found held by another session fail with ErrRecentlyHeld for window
+// afterward instead of querying the server again. This cuts database load when many goroutines in a process poll the
+// same contested lock. Only attempts that don't wait for the lock fail early. Attempts with "WithTimeout" or a ctx
+// deadline always go to the server.
+//
+// Attempts share what they found when they use the same *sql.DB and lock name and both use WithContestedWindow.
+func WithContestedWindow(window time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.contestedWindow = window
+	}
+}
+
+type contestedKey struct {
+	db       *sql.DB
+	lockName string
+}
+
+var (
+	contestedMux sync.Mutex
+	// contested holds when each lock was last found held by another session
+	contested = map[contestedKey]time.Time{}
+)
+
+// recentlyHeld returns whether an attempt at lockName should fail with ErrRecentlyHeld.
+func recentlyHeld(ctx context.Context, db *sql.DB, lockName string, opts *lockOpts) bool {
+	if opts.contestedWindow <= 0 || opts.timeout != 0 || (!opts.noWait && lockWaitSeconds(ctx) != 0) {
+		return false
+	}
+	key := contestedKey{db: db, lockName: lockName}
+	contestedMux.Lock()
+	defer contestedMux.Unlock()
+	seen, ok := contested[key]
+	if !ok {
+		return false
+	}
+	if time.Since(seen) < opts.contestedWindow {
+		return true
+	}
+	delete(contested, key)
+	return false
+}
+
+// setContested records whether lockName was found held by another session.
+func setContested(db *sql.DB, lockName string, opts *lockOpts, held bool) {
+	if opts.contestedWindow <= 0 {
+		return
+	}
+	key := contestedKey{db: db, lockName: lockName}
+	contestedMux.Lock()
+	defer contestedMux.Unlock()
+	if held {
+		contested[key] = time.Now()
+		return
+	}
+	delete(contested, key)
+}
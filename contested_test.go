@@ -0,0 +1,41 @@
+package mysqllocker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithContestedWindow(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	window := WithContestedWindow(500 * time.Millisecond)
+
+	h, err := Acquire(ctx, db, lockName)
+	require.NoError(t, err)
+
+	_, err = Acquire(ctx, db, lockName, window)
+	require.Error(t, err)
+	require.NotEqual(t, ErrRecentlyHeld, err)
+	_, err = Acquire(ctx, db, lockName, window)
+	require.Equal(t, ErrRecentlyHeld, err)
+
+	// waiting attempts still ask the server
+	_, err = Acquire(ctx, db, lockName, window, WithTimeout(time.Second))
+	require.Error(t, err)
+	require.NotEqual(t, ErrRecentlyHeld, err)
+
+	require.NoError(t, h.Release())
+	_, err = Acquire(ctx, db, lockName, window)
+	require.Equal(t, ErrRecentlyHeld, err)
+
+	time.Sleep(500 * time.Millisecond)
+	h, err = Acquire(ctx, db, lockName, window)
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+}
@@ -0,0 +1,137 @@
+// Package dashboard serves an HTML page showing the server's named locks and the locks held by a mysqllocker.Locker.
+package dashboard
+
+import (
+	"database/sql"
+	"html/template"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+const defaultRefresh = 5 * time.Second
+
+type handlerOpts struct {
+	locker  *mysqllocker.Locker
+	refresh time.Duration
+}
+
+// Option is an optional value for Handler
+type Option func(*handlerOpts)
+
+// WithLocker adds a table of the locks held by locker to the page.
+func WithLocker(locker *mysqllocker.Locker) Option {
+	return func(o *handlerOpts) {
+		o.locker = locker
+	}
+}
+
+// WithRefresh sets how often the page reloads itself, rounded up to whole seconds. Default is 5 seconds. Use 0 to
+// disable reloading.
+func WithRefresh(refresh time.Duration) Option {
+	return func(o *handlerOpts) {
+		o.refresh = refresh
+	}
+}
+
+type page struct {
+	Refresh     int
+	ServerLocks []mysqllocker.ServerLock
+	ServerErr   error
+	Local       bool
+	LocalLocks  []localLock
+}
+
+type localLock struct {
+	mysqllocker.LockInfo
+	Age          time.Duration
+	SinceRenew   time.Duration
+	NeverRenewed bool
+}
+
+// Handler returns a handler that serves the dashboard. Server-wide locks come from mysqllocker.ListLocks, so db's
+// user needs SELECT on performance_schema.
+func Handler(db *sql.DB, options ...Option) http.Handler {
+	opts := &handlerOpts{
+		refresh: defaultRefresh,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := page{
+			Refresh: refreshSeconds(opts.refresh),
+		}
+		p.ServerLocks, p.ServerErr = mysqllocker.ListLocks(r.Context(), db)
+		if opts.locker != nil {
+			p.Local = true
+			now := time.Now()
+			for _, info := range opts.locker.HeldLocks() {
+				l := localLock{
+					LockInfo:     info,
+					Age:          now.Sub(info.AcquiredAt).Round(time.Second),
+					NeverRenewed: info.LastRenewal.IsZero(),
+				}
+				if !l.NeverRenewed {
+					l.SinceRenew = now.Sub(info.LastRenewal).Round(time.Second)
+				}
+				p.LocalLocks = append(p.LocalLocks, l)
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = pageTemplate.Execute(w, p) //nolint:errcheck
+	})
+}
+
+// refreshSeconds returns refresh rounded up to whole seconds for the page's refresh header, or 0 for no reloading.
+func refreshSeconds(refresh time.Duration) int {
+	if refresh <= 0 {
+		return 0
+	}
+	return int(math.Ceil(refresh.Seconds()))
+}
+
+var pageTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{- if .Refresh}}
+<meta http-equiv="refresh" content="{{.Refresh}}">
+{{- end}}
+<title>mysqllocker</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.75em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Server locks</h1>
+{{- if .ServerErr}}
+<p>Could not list locks: {{.ServerErr}}</p>
+{{- else}}
+<table>
+<tr><th>Name</th><th>Holder connection</th><th>Waiters</th></tr>
+{{- range .ServerLocks}}
+<tr><td>{{.Name}}</td><td>{{if .ConnectionID}}{{.ConnectionID}}{{else}}-{{end}}</td><td>{{.Waiters}}</td></tr>
+{{- else}}
+<tr><td colspan="3">No locks</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Local}}
+<h1>Held by this process</h1>
+<table>
+<tr><th>Name</th><th>Owner</th><th>Epoch</th><th>Held for</th><th>Last renewal</th></tr>
+{{- range .LocalLocks}}
+<tr><td>{{.Name}}</td><td>{{.OwnerID}}</td><td>{{.Epoch}}</td><td>{{.Age}}</td><td>{{if .NeverRenewed}}never{{else}}{{.SinceRenew}} ago{{end}}</td></tr>
+{{- else}}
+<tr><td colspan="5">No locks</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,39 @@
+package dashboard
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	locker := mysqllocker.NewLocker(db, mysqllocker.WithNamespace("dashboard"))
+	_, err := locker.Acquire(ctx, t.Name())
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	Handler(db, WithLocker(locker)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	require.Contains(t, body, `<meta http-equiv="refresh" content="5">`)
+	require.Equal(t, 1, strings.Count(body, "<td>dashboard:"+t.Name()+"</td><td>"+locker.HeldLocks()[0].OwnerID))
+}
+
+func TestRefreshSeconds(t *testing.T) {
+	require.Equal(t, 0, refreshSeconds(0))
+	require.Equal(t, 0, refreshSeconds(-time.Second))
+	require.Equal(t, 1, refreshSeconds(500*time.Millisecond))
+	require.Equal(t, 5, refreshSeconds(5*time.Second))
+	require.Equal(t, 6, refreshSeconds(5100*time.Millisecond))
+}
@@ -0,0 +1,76 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultDataTable is the table Handle.SetData and GetLockData use when WithDataTable isn't set.
+const DefaultDataTable = "mysqllocker_data"
+
+// WithDataTable sets the table for Handle.SetData and GetLockData. table is used in queries as-is, so it may be
+// qualified with a database name. The table must already exist, such as from EnsureSchema, with at least these
+// columns:
+//
+//	CREATE TABLE mysqllocker_data (
+//	  lock_name VARCHAR(64) NOT NULL PRIMARY KEY,
+//	  data JSON NOT NULL,
+//	  holder VARCHAR(255) NOT NULL,
+//	  connection_id BIGINT UNSIGNED NOT NULL,
+//	  updated_at DATETIME(6) NOT NULL
+//	)
+func WithDataTable(table string) LockOption {
+	return func(o *lockOpts) {
+		o.dataTable = table
+	}
+}
+
+// dataTableName returns the WithDataTable value or DefaultDataTable.
+func (o *lockOpts) dataTableName() string {
+	if o.dataTable != "" {
+		return o.dataTable
+	}
+	return DefaultDataTable
+}
+
+// SetData publishes v as JSON alongside the lock so other processes can read it with GetLockData, for example to
+// report progress. Each call replaces the previous value. The value is only visible while the lock is held.
+func (h *Handle) SetData(ctx context.Context, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`
+INSERT INTO %s (lock_name, data, holder, connection_id, updated_at) VALUES (?, ?, ?, CONNECTION_ID(), NOW(6))
+ON DUPLICATE KEY UPDATE data = VALUES(data), holder = VALUES(holder), connection_id = VALUES(connection_id),
+  updated_at = VALUES(updated_at)`, h.opts.dataTableName())
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	if h.isReleased() {
+		return &LostError{LockName: h.lockName}
+	}
+	_, err = h.conn.ExecContext(ctx, query, h.lockName, string(data), h.opts.owner())
+	return err
+}
+
+// GetLockData returns the data most recently published with Handle.SetData by the current holder of lockName.
+// It returns nil when the lock is free or its holder hasn't published anything. Only the WithDataTable option is
+// used from options.
+func GetLockData(ctx context.Context, db *sql.DB, lockName string, options ...LockOption) (json.RawMessage, error) {
+	opts := newLockOpts(options)
+	query := fmt.Sprintf(
+		`SELECT data FROM %s WHERE lock_name = ? AND connection_id = IS_USED_LOCK(lock_name)`,
+		opts.dataTableName(),
+	)
+	var data []byte
+	err := db.QueryRowContext(ctx, query, lockName).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
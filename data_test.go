@@ -0,0 +1,42 @@
+package mysqllocker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestLockData(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.data_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	require.NoError(t, EnsureSchema(ctx, db, DefaultTableOptions, WithDataTable(table), WithAudit(table+"_audit")))
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h, err := Acquire(lockCtx, db, lockName, WithDataTable(table))
+	require.NoError(t, err)
+	data, err := GetLockData(ctx, db, lockName, WithDataTable(table))
+	require.NoError(t, err)
+	require.Nil(t, data)
+
+	require.NoError(t, h.SetData(ctx, map[string]string{"step": "1/2"}))
+	require.NoError(t, h.SetData(ctx, map[string]string{"step": "2/2"}))
+	data, err = GetLockData(ctx, db, lockName, WithDataTable(table))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"step": "2/2"}`, string(data))
+
+	require.NoError(t, h.Release())
+	data, err = GetLockData(ctx, db, lockName, WithDataTable(table))
+	require.NoError(t, err)
+	require.Nil(t, data)
+	require.Error(t, h.SetData(ctx, "too late"))
+}
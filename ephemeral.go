@@ -0,0 +1,41 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+)
+
+// ephemeralIDLength is the number of hex characters of an ephemeral name's token used in the name.
+const ephemeralIDLength = 24
+
+// EphemeralName returns a new lock name for one-off coordination and an owner token to go with it. The name is
+// prefix, escaped like a LockName part and truncated as needed, followed by "/" and 96 random bits from the token,
+// so it always fits in MaxLockNameLength and is unique without coordination. Use the token with WithOwnerID so other
+// sessions can tell the name's creator holds it, such as with GetBlocker.
+func EphemeralName(prefix string) (name, token string, err error) {
+	token, err = newOwnerToken()
+	if err != nil {
+		return "", "", err
+	}
+	id := token[:ephemeralIDLength]
+	prefix = url.PathEscape(prefix)
+	if room := MaxLockNameLength - len(id) - len(lockNameSeparator); len(prefix) > room {
+		prefix = prefix[:room]
+	}
+	return prefix + lockNameSeparator + id, token, nil
+}
+
+// AcquireEphemeral gets a lock on a new EphemeralName with its token as the WithOwnerID value. Use Handle.Name for
+// the name to share and Handle.Info for the token. Like any lock, it is cleaned up by the server when it is released
+// or its session ends, so nothing is left behind when the process dies. The lock is held until ctx is canceled, like
+// with Acquire.
+func AcquireEphemeral(ctx context.Context, db *sql.DB, prefix string, options ...LockOption) (*Handle, error) {
+	name, token, err := EphemeralName(prefix)
+	if err != nil {
+		return nil, err
+	}
+	// the name is new, so there is nothing to wait for
+	options = append(options[:len(options):len(options)], WithOwnerID(token), WithNoWait())
+	return Acquire(ctx, db, name, options...)
+}
@@ -0,0 +1,39 @@
+package mysqllocker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestEphemeralName(t *testing.T) {
+	name, token, err := EphemeralName("jobs/export")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(name, "jobs%2Fexport/"))
+	require.True(t, strings.HasSuffix(name, "/"+token[:ephemeralIDLength]))
+	other, _, err := EphemeralName("jobs/export")
+	require.NoError(t, err)
+	require.NotEqual(t, name, other)
+
+	name, token, err = EphemeralName(strings.Repeat("ü", 64))
+	require.NoError(t, err)
+	require.Len(t, name, MaxLockNameLength)
+	require.True(t, strings.HasSuffix(name, "/"+token[:ephemeralIDLength]))
+}
+
+func TestAcquireEphemeral(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := AcquireEphemeral(ctx, db, t.Name())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(h.Name(), t.Name()+"/"))
+	require.True(t, strings.HasSuffix(h.Name(), h.Info().OwnerID[:ephemeralIDLength]))
+	_, err = Acquire(ctx, db, h.Name())
+	require.Error(t, err)
+	require.NoError(t, h.Release())
+}
@@ -0,0 +1,128 @@
+package mysqllocker
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ConnError is the error for a lock whose connection failed. The lock's session may have ended, so whether the lock
+// is still held is unknown, and it is reasonable to try getting it again.
+type ConnError struct {
+	LockName string
+	Err      error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("connection for lock %q failed: %v", e.LockName, e.Err)
+}
+
+// Unwrap returns the underlying connection error.
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// LostError is the error for a lock that is definitely no longer held by its session, either because it was
+// released or because another session holds it.
+type LostError struct {
+	LockName string
+	// Owner is the connection id of the session now holding the lock or 0 when the lock is free.
+	Owner int64
+}
+
+func (e *LostError) Error() string {
+	if e.Owner == 0 {
+		return fmt.Sprintf("lock %q was released", e.LockName)
+	}
+	return fmt.Sprintf("lock %q is held by connection %d", e.LockName, e.Owner)
+}
+
+// CheckError is the error for a lock released because its WithRenewalCheck function failed. The lock was still held
+// when the check failed.
+type CheckError struct {
+	LockName string
+	Err      error
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("renewal check for lock %q failed: %v", e.LockName, e.Err)
+}
+
+// Unwrap returns the error from the renewal check.
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// connFailed returns whether err means the lock's connection failed, as opposed to the lock being taken by another
+// session or released.
+func connFailed(err error) bool {
+	var connErr *ConnError
+	return errors.As(err, &connErr) || isBadConn(err)
+}
+
+// isBadConn returns whether err means the connection is dead. The server ends a dead connection's session, which
+// releases its locks.
+func isBadConn(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn)
+}
+
+// TimeoutError is the error for a lock that couldn't be obtained because GET_LOCK() returned 0, meaning another
+// session held the lock for the whole wait. The wait is none at all for attempts that don't wait. Trying again later
+// may succeed.
+type TimeoutError struct {
+	LockName string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("lock %q is held by another session", e.LockName)
+}
+
+// Timeout returns true.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// GetLockError is the error for a GET_LOCK() that returned NULL, which the server does when getting the lock fails
+// with an error, such as running out of memory or the thread being killed. It says nothing about whether another
+// session holds the lock. IsTransient reports it as transient.
+type GetLockError struct {
+	LockName string
+}
+
+func (e *GetLockError) Error() string {
+	return fmt.Sprintf("GET_LOCK() returned NULL for lock %q", e.LockName)
+}
+
+// BlockedError is the error for a lock that couldn't be obtained, or timed out waiting, because another session held
+// it. It is only returned with WithBlockerDiagnostics.
+type BlockedError struct {
+	LockName string
+	// Blocker describes the session that held the lock when the acquisition failed.
+	Blocker BlockerInfo
+	// Err is the error from waiting for the lock, such as context.DeadlineExceeded or a *TimeoutError.
+	Err error
+}
+
+func (e *BlockedError) Error() string {
+	msg := fmt.Sprintf("could not obtain lock: lock %q is held by connection %d", e.LockName, e.Blocker.ConnectionID)
+	if e.Blocker.OwnerID != "" {
+		msg += fmt.Sprintf(" owned by %q", e.Blocker.OwnerID)
+	}
+	if e.Blocker.HeldFor > 0 {
+		msg += fmt.Sprintf(" for %v", e.Blocker.HeldFor)
+	}
+	// a *TimeoutError only repeats that the lock is held
+	var timeoutErr *TimeoutError
+	if e.Err != nil && !errors.As(e.Err, &timeoutErr) {
+		msg += fmt.Sprintf(": %v", e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the error from waiting for the lock.
+func (e *BlockedError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,158 @@
+package mysqllocker
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of a lock lifecycle Event.
+type EventType string
+
+// Lock lifecycle events. These are also the event names written by WithAudit.
+const (
+	// EventAcquire is sent when the lock is acquired.
+	EventAcquire EventType = "acquire"
+	// EventTakeover is sent instead of EventAcquire when the lock was acquired after waiting on another session.
+	EventTakeover EventType = "takeover"
+	// EventRenewFail is sent when the lock is released because of an error, such as the lock being lost.
+	EventRenewFail EventType = "renew_fail"
+	// EventRelease is sent when the lock is released without an error.
+	EventRelease EventType = "release"
+	// EventSlowRenewal is sent when a check of the lock is slower than the warn threshold from WithRenewalSLO.
+	EventSlowRenewal EventType = "slow_renewal"
+	// EventUncertain is sent instead of EventSlowRenewal when a check is slower than the uncertain threshold from
+	// WithRenewalSLO.
+	EventUncertain EventType = "uncertain"
+)
+
+// Event is a lock lifecycle event.
+type Event struct {
+	Type     EventType
+	LockName string
+	// ConnectionID is the mysql connection id of the lock's session.
+	ConnectionID int64
+	// OwnerID is the WithOwnerID value.
+	OwnerID string
+	Time    time.Time
+	// Err is the error that ended the lock for EventRenewFail.
+	Err error
+	// Latency is how long the check took for EventSlowRenewal and EventUncertain.
+	Latency time.Duration
+}
+
+// EventSink receives lock lifecycle events. Publish is called synchronously from the goroutine acquiring or holding
+// the lock, so it must not block for long.
+type EventSink interface {
+	Publish(event Event)
+}
+
+// EventSinkFunc is an EventSink that calls itself.
+type EventSinkFunc func(event Event)
+
+// Publish calls f(event).
+func (f EventSinkFunc) Publish(event Event) {
+	f(event)
+}
+
+// WithEventSink sends the lock's lifecycle events to sink. It can be used more than once to add several sinks.
+func WithEventSink(sink EventSink) LockOption {
+	return func(o *lockOpts) {
+		o.eventSinks = append(o.eventSinks, sink)
+	}
+}
+
+// LogSink returns an EventSink that writes events to logger, or the standard logger when logger is nil.
+func LogSink(logger *log.Logger) EventSink {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return EventSinkFunc(func(event Event) {
+		if event.Err != nil {
+			logger.Printf("mysqllocker: %s %q (connection %d, owner %s): %v",
+				event.Type, event.LockName, event.ConnectionID, event.OwnerID, event.Err)
+			return
+		}
+		if event.Latency != 0 {
+			logger.Printf("mysqllocker: %s %q (connection %d, owner %s): check took %v",
+				event.Type, event.LockName, event.ConnectionID, event.OwnerID, event.Latency)
+			return
+		}
+		logger.Printf("mysqllocker: %s %q (connection %d, owner %s)",
+			event.Type, event.LockName, event.ConnectionID, event.OwnerID)
+	})
+}
+
+// ChanSink returns an EventSink that sends events to ch. Events are dropped when ch is full, so a slow reader
+// can't hold up a lock.
+func ChanSink(ch chan<- Event) EventSink {
+	return EventSinkFunc(func(event Event) {
+		select {
+		case ch <- event:
+		default:
+		}
+	})
+}
+
+// emit records an event with the audit table and the lock's event sinks. ex is used for the audit table.
+func (h *Handle) emit(ex execer, eventType EventType, eventErr error) {
+	h.publish(ex, Event{Type: eventType, Err: eventErr})
+}
+
+// publish audits event and sends it to the event sinks after filling in the lock's details.
+func (h *Handle) publish(ex execer, event Event) {
+	h.audit(ex, event.Type, event.Err)
+	subscribed := h.subs.subscribed()
+	if len(h.opts.eventSinks) == 0 && !subscribed {
+		return
+	}
+	event.LockName = h.lockName
+	event.ConnectionID = h.connectionID
+	event.OwnerID = h.opts.owner()
+	event.Time = time.Now()
+	for _, sink := range h.opts.eventSinks {
+		sink.Publish(event)
+	}
+	if subscribed {
+		h.subs.Publish(event)
+	}
+}
+
+// eventSubs are the channels of a Handle's running Events iterators. Reentrant handles share them.
+type eventSubs struct {
+	mux   sync.Mutex
+	chans map[chan Event]struct{}
+}
+
+func (s *eventSubs) subscribe(ch chan Event) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.chans == nil {
+		s.chans = map[chan Event]struct{}{}
+	}
+	s.chans[ch] = struct{}{}
+}
+
+func (s *eventSubs) unsubscribe(ch chan Event) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.chans, ch)
+}
+
+func (s *eventSubs) subscribed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.chans) > 0
+}
+
+// Publish sends event to each subscribed channel, dropping it for channels that are full like ChanSink.
+func (s *eventSubs) Publish(event Event) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for ch := range s.chans {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package mysqllocker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithEventSink(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	events := make(chan Event, 10)
+	var logged bytes.Buffer
+	h, err := Acquire(ctx, db, lockName,
+		WithEventSink(ChanSink(events)),
+		WithEventSink(LogSink(log.New(&logged, "", 0))),
+		WithOwnerID("event-test"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+
+	acquired := <-events
+	require.Equal(t, EventAcquire, acquired.Type)
+	require.Equal(t, lockName, acquired.LockName)
+	require.Equal(t, "event-test", acquired.OwnerID)
+	require.NotZero(t, acquired.ConnectionID)
+	released := <-events
+	require.Equal(t, EventRelease, released.Type)
+	require.Equal(t, acquired.ConnectionID, released.ConnectionID)
+	require.Contains(t, logged.String(), `mysqllocker: release "`+lockName+`"`)
+}
+
+func TestChanSink(t *testing.T) {
+	events := make(chan Event, 1)
+	sink := ChanSink(events)
+	sink.Publish(Event{Type: EventAcquire})
+	// dropped instead of blocking
+	sink.Publish(Event{Type: EventRenewFail, Err: errors.New("lost")})
+	require.Equal(t, EventAcquire, (<-events).Type)
+	require.Empty(t, events)
+}
@@ -0,0 +1,46 @@
+//go:build go1.23
+
+package mysqllocker
+
+import "iter"
+
+// eventsBuffer is how many events an Events iterator holds for a slow loop body before dropping them.
+const eventsBuffer = 16
+
+// Events returns an iterator over the lock's lifecycle events from when iteration starts, as an alternative to
+// WithEventSink and ChanSink:
+//
+//	for event := range h.Events() {
+//		log.Println(event.Type)
+//	}
+//
+// The loop ends after the lock is released and its last event, EventRelease or EventRenewFail, has been yielded, so
+// there is no channel to drain or goroutine to stop. Events are dropped while the loop body is too slow to keep up,
+// like ChanSink. ConnectionID is only set on events when WithAudit or WithEventSink is used too.
+func (h *Handle) Events() iter.Seq[Event] {
+	return func(yield func(Event) bool) {
+		ch := make(chan Event, eventsBuffer)
+		h.subs.subscribe(ch)
+		defer h.subs.unsubscribe(ch)
+		for {
+			select {
+			case event := <-ch:
+				if !yield(event) {
+					return
+				}
+			case <-h.done:
+				// the last event is sent before done is closed
+				for {
+					select {
+					case event := <-ch:
+						if !yield(event) {
+							return
+						}
+					default:
+						return
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package mysqllocker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestHandleEvents(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	h, err := Acquire(ctx, db, lockName, WithPingInterval(10*time.Millisecond),
+		WithRenewalSLO(time.Nanosecond, 0))
+	require.NoError(t, err)
+
+	var types []EventType
+	for event := range h.Events() {
+		require.Equal(t, lockName, event.LockName)
+		types = append(types, event.Type)
+		if len(types) == 2 {
+			go h.Release() //nolint:errcheck
+		}
+	}
+	require.GreaterOrEqual(t, len(types), 3)
+	require.Equal(t, EventSlowRenewal, types[0])
+	require.Equal(t, EventRelease, types[len(types)-1])
+
+	// iterating after the lock is released ends right away
+	for range h.Events() {
+		t.Fatal("unexpected event")
+	}
+}
@@ -0,0 +1,90 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// FailoverEvent is sent by LockFailover when the lock is obtained or lost.
+type FailoverEvent struct {
+	// Epoch is incremented each time the lock is obtained. Work done under an earlier epoch was not protected by the
+	// lock after that epoch's loss event.
+	Epoch int
+	// DB is the index of the db holding the lock or -1 when the lock was lost.
+	DB int
+	// Err is why the lock was lost. It is nil when the lock was obtained.
+	Err error
+}
+
+// Held returns true when the event reports the lock being obtained.
+func (e FailoverEvent) Held() bool {
+	return e.DB >= 0
+}
+
+// LockFailover gets lockName on the first of dbs that it can and holds it until ctx is canceled. When the connection
+// to the db holding the lock fails, it sends an event for the loss and tries to get the lock again on the following
+// dbs in order, wrapping around to the start of the list.
+// The returned channel receives an event for the initial lock, then a pair of events for each move to another db.
+// When the lock ends for any other reason, such as another session on the same db taking it, or no db can be locked
+// after a loss, the last event sent is the loss, and the channel is closed. Moving then could leave two holders. The
+// channel is also closed after the lock is released when ctx is canceled.
+func LockFailover(ctx context.Context, dbs []*sql.DB, lockName string, options ...LockOption) (<-chan FailoverEvent, error) {
+	h, idx, err := acquireFirst(ctx, dbs, 0, lockName, options)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan FailoverEvent, 2)
+	epoch := 1
+	events <- FailoverEvent{Epoch: epoch, DB: idx}
+
+	send := func(ev FailoverEvent) bool {
+		select {
+		case events <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(events)
+		for {
+			<-h.Done()
+			if ctx.Err() != nil {
+				return
+			}
+			lostErr := h.Err()
+			if lostErr == nil {
+				lostErr = fmt.Errorf("lock released on db %d", idx)
+			}
+			if !send(FailoverEvent{Epoch: epoch, DB: -1, Err: lostErr}) || !connFailed(lostErr) {
+				return
+			}
+			h, idx, err = acquireFirst(ctx, dbs, idx+1, lockName, options)
+			if err != nil {
+				return
+			}
+			epoch++
+			if !send(FailoverEvent{Epoch: epoch, DB: idx}) {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// acquireFirst tries each of dbs starting with the one at index start and returns the first lock obtained along
+// with the index of its db.
+func acquireFirst(ctx context.Context, dbs []*sql.DB, start int, lockName string, options []LockOption) (*Handle, int, error) {
+	err := fmt.Errorf("could not obtain lock: no dbs")
+	for i := range dbs {
+		idx := (start + i) % len(dbs)
+		var h *Handle
+		h, err = Acquire(ctx, dbs[idx], lockName, options...)
+		if err == nil {
+			return h, idx, nil
+		}
+	}
+	return nil, -1, err
+}
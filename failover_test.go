@@ -0,0 +1,99 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestLockFailover(t *testing.T) {
+	t.Run("locks", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := LockFailover(ctx, []*sql.DB{db}, lockName)
+		require.NoError(t, err)
+		ev := <-events
+		require.True(t, ev.Held())
+		require.Equal(t, 1, ev.Epoch)
+		require.Equal(t, 0, ev.DB)
+		cancel()
+		for range events {
+		}
+	})
+
+	t.Run("moves when the connection fails", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var failures int32
+		events, err := LockFailover(ctx, []*sql.DB{db, db}, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithFaults(func(point FaultPoint) error {
+				if point == FaultCheck && atomic.AddInt32(&failures, 1) == 1 {
+					return errors.New("injected connection failure")
+				}
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, 0, (<-events).DB)
+		lost := <-events
+		require.False(t, lost.Held())
+		var connErr *ConnError
+		require.True(t, errors.As(lost.Err, &connErr))
+		moved := <-events
+		require.Equal(t, 1, moved.DB)
+		require.Equal(t, 2, moved.Epoch)
+		cancel()
+		for range events {
+		}
+	})
+
+	t.Run("doesn't move when the lock is taken", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := LockFailover(ctx, []*sql.DB{db, db}, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithFaults(func(point FaultPoint) error {
+				if point == FaultCheck {
+					return &LostError{LockName: lockName, Owner: 1}
+				}
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		require.True(t, (<-events).Held())
+		lost := <-events
+		var lostErr *LostError
+		require.True(t, errors.As(lost.Err, &lostErr))
+		_, open := <-events
+		require.False(t, open)
+	})
+
+	t.Run("errors when no db can be locked", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := Lock(ctx, db, lockName)
+		require.NoError(t, err)
+		events, err := LockFailover(ctx, []*sql.DB{db, db}, lockName)
+		require.Error(t, err)
+		require.Nil(t, events)
+	})
+}
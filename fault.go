@@ -0,0 +1,45 @@
+package mysqllocker
+
+// FaultPoint is a point in a lock's life where WithFaults can inject a failure.
+type FaultPoint int
+
+const (
+	// FaultAcquire is right before GET_LOCK. An injected error fails the acquisition.
+	FaultAcquire FaultPoint = iota + 1
+	// FaultCheck is right before each check that the lock is still held. An injected *LostError is handled as
+	// another session taking the lock. Any other error is handled as a failed check, as if the connection dropped,
+	// so it is subject to WithFailureThreshold and WithGracePeriod.
+	FaultCheck
+	// FaultRelease is right before the lock is released. The lock is still released, but the injected error is
+	// reported as the release error.
+	FaultRelease
+)
+
+func (p FaultPoint) String() string {
+	switch p {
+	case FaultAcquire:
+		return "acquire"
+	case FaultCheck:
+		return "check"
+	case FaultRelease:
+		return "release"
+	default:
+		return "unknown"
+	}
+}
+
+// WithFaults calls inject at each FaultPoint and fails the operation there with the returned error when it isn't nil.
+// It is meant for tests that need to exercise lock-loss handling deterministically.
+func WithFaults(inject func(point FaultPoint) error) LockOption {
+	return func(o *lockOpts) {
+		o.faults = inject
+	}
+}
+
+// fault returns the error injected at point, if any.
+func (o *lockOpts) fault(point FaultPoint) error {
+	if o.faults == nil {
+		return nil
+	}
+	return o.faults(point)
+}
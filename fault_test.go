@@ -0,0 +1,72 @@
+package mysqllocker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithFaults(t *testing.T) {
+	errInjected := errors.New("injected")
+
+	t.Run("acquire", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		_, err := Acquire(context.Background(), db, lockName, WithFaults(func(point FaultPoint) error {
+			if point == FaultAcquire {
+				return errInjected
+			}
+			return nil
+		}))
+		require.Error(t, err)
+	})
+
+	t.Run("check", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithFailureThreshold(2),
+			WithFaults(func(point FaultPoint) error {
+				if point == FaultCheck {
+					return errInjected
+				}
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		<-h.Done()
+		var connErr *ConnError
+		require.True(t, errors.As(h.Err(), &connErr))
+		require.True(t, errors.Is(h.Err(), errInjected))
+	})
+
+	t.Run("release", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithFaults(func(point FaultPoint) error {
+			if point == FaultRelease {
+				return errInjected
+			}
+			return nil
+		}))
+		require.NoError(t, err)
+		cancel()
+		<-h.Done()
+		require.Equal(t, errInjected, h.Err())
+		owner, err := GetLockOwner(context.Background(), db, lockName)
+		require.NoError(t, err)
+		require.Nil(t, owner)
+	})
+}
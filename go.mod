@@ -1,8 +1,14 @@
 module github.com/willabides/mysqllocker
 
-go 1.14
+go 1.20
 
 require (
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/stretchr/testify v1.5.1
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 )
@@ -0,0 +1,370 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group is a set of locks held together on a single connection by AcquireGroup. All of the group's locks are
+// checked with one query per tick, so a process can hold many locks without a connection and a query for each.
+type Group struct {
+	names []string
+	opts  *lockOpts
+	conn  *sql.Conn
+	token string
+	// connMux keeps Check and the hold loop from using conn at the same time. It guards checkStmt and released.
+	connMux   sync.Mutex
+	checkStmt *sql.Stmt
+	// restoreSession undoes WithSessionTimeouts when the group is released
+	restoreSession string
+	released       bool
+	done           chan struct{}
+	err            error
+	cancel         context.CancelFunc
+}
+
+// AcquireGroup gets every lock in names on one connection and holds them until ctx is canceled, Release is called
+// or any of them is lost, at which point all of them are released. Names are acquired in sorted order so groups
+// with overlapping names can't deadlock each other. When a lock is unavailable and "WithTimeout" is set, it waits
+// up to the timeout for all of the locks.
+//
+// These options apply to groups: WithTimeout, WithPingInterval, WithRenewTimeout, WithReleaseTimeout,
+// WithFailureThreshold, WithGracePeriod, WithSessionInit, WithSessionTimeouts, WithOwnerID, WithQueryComments and
+// WithErrorHandler.
+func AcquireGroup(ctx context.Context, db *sql.DB, names []string, options ...LockOption) (*Group, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("could not obtain lock: no lock names")
+	}
+	opts := newLockOpts(options)
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	acquireCtx := ctx
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		acquireCtx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	conn, err := getConn(acquireCtx, db)
+	if err != nil {
+		return nil, err
+	}
+	g := &Group{
+		names: sorted,
+		opts:  opts,
+		conn:  conn,
+		done:  make(chan struct{}),
+	}
+	err = g.acquire(acquireCtx)
+	if err == nil {
+		err = g.setup(acquireCtx)
+	}
+	if err != nil {
+		_ = g.release() //nolint:errcheck
+		return nil, fmt.Errorf("could not obtain lock: %w", err)
+	}
+	g.start(ctx)
+	return g, nil
+}
+
+// TryLockMany tries to get each lock in names without waiting, all on one connection, and returns which were
+// acquired. The acquired locks are held together as a Group until ctx is canceled, like with AcquireGroup. The Group
+// is nil when no locks were acquired. This suits schedulers that claim whatever work is free.
+//
+// It takes the same options as AcquireGroup, except that WithTimeout is ignored.
+func TryLockMany(ctx context.Context, db *sql.DB, names []string, options ...LockOption) (*Group, map[string]bool, error) {
+	opts := newLockOpts(append(options[:len(options):len(options)], WithNoWait()))
+	acquired := make(map[string]bool, len(names))
+	for _, name := range names {
+		acquired[name] = false
+	}
+	if len(acquired) == 0 {
+		return nil, acquired, nil
+	}
+	sorted := make([]string, 0, len(acquired))
+	for name := range acquired {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	conn, err := getConn(ctx, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	g := &Group{
+		opts: opts,
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	err = g.initSession(ctx)
+	for _, name := range sorted {
+		if err != nil {
+			break
+		}
+		var ok bool
+		ok, err = getLock(ctx, conn, name, opts)
+		if ok {
+			acquired[name] = true
+			g.names = append(g.names, name)
+		}
+	}
+	if err == nil && len(g.names) == 0 {
+		_ = conn.Close() //nolint:errcheck
+		return nil, acquired, nil
+	}
+	if err == nil {
+		err = g.setup(ctx)
+	}
+	if err != nil {
+		if len(g.names) == 0 {
+			_ = conn.Close() //nolint:errcheck
+		} else {
+			_ = g.release() //nolint:errcheck
+		}
+		return nil, nil, fmt.Errorf("could not obtain lock: %w", err)
+	}
+	g.start(ctx)
+	return g, acquired, nil
+}
+
+// start records the group's locks as acquired and starts holding them until ctx is canceled.
+func (g *Group) start(ctx context.Context) {
+	for range g.names {
+		recordAcquired()
+	}
+	ctx, g.cancel = context.WithCancel(ctx)
+	goHold(ctx, strings.Join(g.names, ","), g.hold)
+}
+
+// initSession runs the session init statements.
+func (g *Group) initSession(ctx context.Context) error {
+	for _, stmt := range g.opts.sessionInit {
+		_, err := g.conn.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquire runs the session init statements and gets all of the locks.
+func (g *Group) acquire(ctx context.Context) error {
+	err := g.initSession(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range g.names {
+		ok, err := getLock(ctx, g.conn, name, g.opts)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &TimeoutError{LockName: name}
+		}
+	}
+	return nil
+}
+
+// setup sets the session's owner, configures the session and prepares the check statement once the locks are held.
+func (g *Group) setup(ctx context.Context) error {
+	var err error
+	g.token, err = newOwnerToken()
+	if err != nil {
+		return err
+	}
+	err = setOwner(ctx, g.conn, g.token, g.opts.owner())
+	if err != nil {
+		return err
+	}
+	g.restoreSession, err = configureSession(ctx, g.conn, g.opts)
+	if err != nil {
+		return err
+	}
+	g.checkStmt, err = g.conn.PrepareContext(ctx, g.opts.commented(ctx, g.names[0], groupCheckQuery(len(g.names))))
+	return err
+}
+
+// groupCheckQuery returns a query checking n locks that selects the session's token followed by whether the session
+// holds each lock.
+func groupCheckQuery(n int) string {
+	cols := make([]string, n)
+	for i := range cols {
+		cols[i] = "IS_USED_LOCK(?) <=> CONNECTION_ID()"
+	}
+	return "SELECT @mysqllocker_token, " + strings.Join(cols, ", ")
+}
+
+// Names returns the names of the group's locks in sorted order.
+func (g *Group) Names() []string {
+	return append([]string(nil), g.names...)
+}
+
+// Done returns a channel that is closed when the group's locks are released.
+func (g *Group) Done() <-chan struct{} {
+	return g.done
+}
+
+// Err returns the error that caused the group to be released, like Handle.Err. When locks were lost, it is a
+// *LostError for the first lost lock.
+func (g *Group) Err() error {
+	select {
+	case <-g.done:
+		return g.err
+	default:
+		return nil
+	}
+}
+
+// Check checks every lock in the group with a single query and returns the names of the locks the group no longer
+// holds. Like Handle.Touch, it doesn't release anything. The regular checks decide that.
+func (g *Group) Check(ctx context.Context) ([]string, error) {
+	g.connMux.Lock()
+	defer g.connMux.Unlock()
+	if g.released {
+		return g.Names(), nil
+	}
+	return g.check(ctx)
+}
+
+// check implements Check. The caller must hold connMux.
+func (g *Group) check(ctx context.Context) ([]string, error) {
+	var token sql.NullString
+	held := make([]sql.NullBool, len(g.names))
+	dest := make([]interface{}, 0, len(g.names)+1)
+	dest = append(dest, &token)
+	args := make([]interface{}, len(g.names))
+	for i, name := range g.names {
+		dest = append(dest, &held[i])
+		args[i] = name
+	}
+	err := g.checkStmt.QueryRowContext(ctx, args...).Scan(dest...)
+	if err != nil {
+		return nil, &ConnError{LockName: g.names[0], Err: err}
+	}
+	if token.String != g.token {
+		return g.Names(), nil
+	}
+	var lost []string
+	for i, name := range g.names {
+		if !held[i].Bool {
+			lost = append(lost, name)
+		}
+	}
+	return lost, nil
+}
+
+// Release releases the group's locks and returns the error that ended the group, like Err.
+func (g *Group) Release() error {
+	g.cancel()
+	<-g.done
+	return g.err
+}
+
+// Close is the same as Release. It lets Group be used as an io.Closer.
+func (g *Group) Close() error {
+	return g.Release()
+}
+
+// hold checks the group's locks until ctx is done or a lock is lost, then releases them.
+func (g *Group) hold(ctx context.Context) {
+	acquiredAt := time.Now()
+	ticker := time.NewTicker(g.opts.pingInterval)
+	defer ticker.Stop()
+	var lErr error
+	var failures int
+	var failingSince time.Time
+	for lErr == nil {
+		select {
+		case <-ctx.Done():
+			lErr = ctx.Err()
+		case <-ticker.C:
+			lost, err := g.renew(ctx)
+			if err == nil && len(lost) == 0 {
+				failures = 0
+				break
+			}
+			if ctx.Err() != nil {
+				lErr = ctx.Err()
+				break
+			}
+			recordRenewalFailure()
+			if err == nil {
+				lErr = &LostError{LockName: lost[0]}
+				break
+			}
+			// a dead connection's session is gone along with its locks, so there is nothing to wait out
+			if isBadConn(err) {
+				lErr = err
+				break
+			}
+			if failures == 0 {
+				failingSince = time.Now()
+			}
+			failures++
+			if g.opts.lostAfter(failures, time.Since(failingSince)) {
+				lErr = err
+			}
+		}
+	}
+	g.connMux.Lock()
+	releaseErr := ignoreErr(g.release())
+	g.released = true
+	g.connMux.Unlock()
+	for range g.names {
+		recordReleased(time.Since(acquiredAt))
+	}
+	if releaseErr != nil {
+		lErr = releaseErr
+	}
+	g.err = ignoreErr(lErr)
+	lost := g.err != nil
+	if !lost && ctx.Err() != nil {
+		// a cancel cause is reported by Err, but the locks were released as asked, not lost
+		g.err = ignoreErr(context.Cause(ctx))
+	}
+	close(g.done)
+	if lost && g.opts.errorHandler != nil {
+		g.opts.errorHandler(g.err)
+	}
+}
+
+// renew runs a regular check bounded by the WithRenewTimeout deadline.
+func (g *Group) renew(ctx context.Context) ([]string, error) {
+	if g.opts.renewTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.opts.renewTimeout)
+		defer cancel()
+	}
+	g.connMux.Lock()
+	defer g.connMux.Unlock()
+	return g.check(ctx)
+}
+
+// release releases all of the group's locks with RELEASE_ALL_LOCKS() and closes the connection.
+func (g *Group) release() error {
+	ctx := context.Background()
+	if g.opts.releaseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.opts.releaseTimeout)
+		defer cancel()
+	}
+	if g.checkStmt != nil {
+		_ = g.checkStmt.Close() //nolint:errcheck
+	}
+	err := releaseAllLocks(ctx, g.conn, g.names, g.opts)
+	// if the connection is already closed, then the locks are already released
+	if isBadConn(err) {
+		err = nil
+	}
+	if err == nil && g.restoreSession != "" {
+		_, _ = g.conn.ExecContext(ctx, g.restoreSession) //nolint:errcheck
+	}
+	closeErr := g.conn.Close()
+	if err == nil && !isBadConn(closeErr) {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package mysqllocker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestAcquireGroup(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	names := []string{t.Name() + "/c", t.Name() + "/a", t.Name() + "/b"}
+	g, err := AcquireGroup(ctx, db, names, WithPingInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, []string{t.Name() + "/a", t.Name() + "/b", t.Name() + "/c"}, g.Names())
+	lost, err := g.Check(ctx)
+	require.NoError(t, err)
+	require.Empty(t, lost)
+
+	// every lock is held
+	for _, name := range names {
+		_, err = Acquire(ctx, db, name)
+		require.Error(t, err)
+	}
+	// a group overlapping a held group fails
+	_, err = AcquireGroup(ctx, db, []string{t.Name() + "/0", t.Name() + "/b"})
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr))
+	require.Equal(t, t.Name()+"/b", timeoutErr.LockName)
+	_, err = Acquire(ctx, db, t.Name()+"/0", WithTimeout(time.Second))
+	require.NoError(t, err, "a failed group releases the locks it got")
+
+	// losing one lock releases the group
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck
+	var connectionID int64
+	require.NoError(t, conn.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?)`, t.Name()+"/b").Scan(&connectionID))
+	_, err = conn.ExecContext(ctx, `KILL ?`, connectionID)
+	require.NoError(t, err)
+	<-g.Done()
+	var connErr *ConnError
+	require.True(t, errors.As(g.Err(), &connErr))
+	for _, name := range names {
+		_, err = Acquire(ctx, db, name, WithTimeout(time.Second))
+		require.NoError(t, err)
+	}
+}
+
+func TestGroupCheck(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	names := []string{t.Name() + "/a", t.Name() + "/b"}
+	g, err := AcquireGroup(ctx, db, names)
+	require.NoError(t, err)
+	// release one lock behind the group's back
+	g.connMux.Lock()
+	_, err = g.conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, names[1])
+	g.connMux.Unlock()
+	require.NoError(t, err)
+	lost, err := g.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{names[1]}, lost)
+	require.NoError(t, g.Release())
+}
+
+func TestGroupDeadConn(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	names := []string{t.Name() + "/a", t.Name() + "/b"}
+	g, err := AcquireGroup(ctx, db, names, WithPingInterval(10*time.Millisecond), WithGracePeriod(time.Hour))
+	require.NoError(t, err)
+	g.connMux.Lock()
+	err = g.conn.Close()
+	g.connMux.Unlock()
+	require.NoError(t, err)
+	select {
+	case <-g.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("group kept waiting out the grace period on a closed connection")
+	}
+	require.True(t, isBadConn(g.Err()))
+}
+
+func TestTryLockMany(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, b, c := t.Name()+"/a", t.Name()+"/b", t.Name()+"/c"
+	h, err := Acquire(ctx, db, b)
+	require.NoError(t, err)
+
+	g, acquired, err := TryLockMany(ctx, db, []string{c, b, a})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{a: true, b: false, c: true}, acquired)
+	require.Equal(t, []string{a, c}, g.Names())
+	_, err = Acquire(ctx, db, a)
+	require.Error(t, err)
+
+	g2, acquired, err := TryLockMany(ctx, db, []string{a, b})
+	require.NoError(t, err)
+	require.Nil(t, g2)
+	require.Equal(t, map[string]bool{a: false, b: false}, acquired)
+
+	require.NoError(t, g.Release())
+	require.NoError(t, h.Release())
+	g, acquired, err = TryLockMany(ctx, db, []string{a, b})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{a: true, b: true}, acquired)
+	require.NoError(t, g.Release())
+}
@@ -0,0 +1,168 @@
+package guard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// DefaultHandoffWait is how long TakeOver waits for the old process to hand over the lock by default.
+const DefaultHandoffWait = 30 * time.Second
+
+// Handoff states published with the lock's data.
+const (
+	// HandoffActive is published by the holder once it has the lock.
+	HandoffActive = "active"
+	// HandoffReleasing is published by the holder just before it releases the lock to hand it over.
+	HandoffReleasing = "releasing"
+)
+
+// HandoffData is what the holders of a Single lock publish with mysqllocker.Handle.SetData during a blue/green
+// deploy, so each side can log who it is handing over to or taking over from.
+type HandoffData struct {
+	Owner string `json:"owner"`
+	State string `json:"state"`
+	// Previous is the owner the lock was taken over from.
+	Previous string    `json:"previous,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+type handoffOpts struct {
+	wait        time.Duration
+	logf        func(format string, args ...interface{})
+	signals     []os.Signal
+	lockOptions []mysqllocker.LockOption
+}
+
+// HandoffOption is an optional value for TakeOver, HandOff and ReleaseOnSignal
+type HandoffOption func(*handoffOpts)
+
+// WithHandoffWait sets how long TakeOver waits for the old process to release the lock. Default is
+// DefaultHandoffWait.
+func WithHandoffWait(wait time.Duration) HandoffOption {
+	return func(o *handoffOpts) {
+		o.wait = wait
+	}
+}
+
+// WithHandoffLogger sets the function handoff progress is logged with. Default is log.Printf.
+func WithHandoffLogger(logf func(format string, args ...interface{})) HandoffOption {
+	return func(o *handoffOpts) {
+		o.logf = logf
+	}
+}
+
+// WithHandoffSignals sets the signals ReleaseOnSignal hands over the lock on. Default is SIGTERM and os.Interrupt.
+func WithHandoffSignals(signals ...os.Signal) HandoffOption {
+	return func(o *handoffOpts) {
+		o.signals = signals
+	}
+}
+
+// WithHandoffLockOptions sets options for the lock TakeOver gets. Pass mysqllocker.WithDataTable here when the lock's
+// data isn't in mysqllocker.DefaultDataTable.
+func WithHandoffLockOptions(options ...mysqllocker.LockOption) HandoffOption {
+	return func(o *handoffOpts) {
+		o.lockOptions = append(o.lockOptions, options...)
+	}
+}
+
+func newHandoffOpts(options []HandoffOption) *handoffOpts {
+	opts := &handoffOpts{
+		wait:    DefaultHandoffWait,
+		logf:    log.Printf,
+		signals: []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
+
+// TakeOver is Single for the new process in a blue/green deploy. It waits for the old process to release
+// SingleLockName(appName), such as with ReleaseOnSignal, and holds the lock as owner until ctx is canceled. Both
+// sides log the handoff, and the lock's data records who took over from whom. The data needs the table from
+// mysqllocker.EnsureSchema, but the handoff still works without it.
+func TakeOver(ctx context.Context, db *sql.DB, appName, owner string, options ...HandoffOption) (*mysqllocker.Handle, error) {
+	opts := newHandoffOpts(options)
+	lockName := SingleLockName(appName)
+	var previous HandoffData
+	data, err := mysqllocker.GetLockData(ctx, db, lockName, opts.lockOptions...)
+	if err == nil && data != nil {
+		err = json.Unmarshal(data, &previous)
+	}
+	if err != nil {
+		opts.logf("guard: %s: could not read handoff data: %v", appName, err)
+	}
+	if previous.Owner != "" {
+		opts.logf("guard: %s: %s waiting for %s (%s) to hand over", appName, owner, previous.Owner, previous.State)
+	}
+	start := time.Now()
+	lockOptions := append([]mysqllocker.LockOption{mysqllocker.WithTimeout(opts.wait)}, opts.lockOptions...)
+	lockOptions = append(lockOptions, mysqllocker.WithOwnerID(owner))
+	h, err := mysqllocker.Acquire(ctx, db, lockName, lockOptions...)
+	if err != nil {
+		opts.logf("guard: %s: %s could not take over after %v: %v", appName, owner, time.Since(start), err)
+		return nil, err
+	}
+	opts.logf("guard: %s: %s took over after %v", appName, owner, time.Since(start))
+	publishHandoff(ctx, h, appName, HandoffData{Owner: owner, State: HandoffActive, Previous: previous.Owner}, opts)
+	return h, nil
+}
+
+// HandOff is the old process's side of a blue/green deploy. It records that owner is handing over h's lock and
+// releases it so the new process's TakeOver gets it right away.
+func HandOff(ctx context.Context, h *mysqllocker.Handle, owner string, options ...HandoffOption) error {
+	opts := newHandoffOpts(options)
+	publishHandoff(ctx, h, h.Name(), HandoffData{Owner: owner, State: HandoffReleasing}, opts)
+	err := h.Release()
+	if err != nil {
+		opts.logf("guard: %s: %s released with error: %v", h.Name(), owner, err)
+		return err
+	}
+	opts.logf("guard: %s: %s released for handoff", h.Name(), owner)
+	return nil
+}
+
+// ReleaseOnSignal calls HandOff when the process receives one of the WithHandoffSignals signals, SIGTERM and
+// os.Interrupt by default. The signals are no longer caught after that, so a second one stops the process as usual.
+// Watch h.Done to exit once the lock is handed over. stop stops watching for the signals without handing over.
+func ReleaseOnSignal(h *mysqllocker.Handle, owner string, options ...HandoffOption) (stop func()) {
+	opts := newHandoffOpts(options)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, opts.signals...)
+	stopped := make(chan struct{})
+	var stopOnce sync.Once
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			opts.logf("guard: %s: %s got %v, handing over", h.Name(), owner, sig)
+			_ = HandOff(context.Background(), h, owner, options...) //nolint:errcheck
+		case <-h.Done():
+		case <-stopped:
+		}
+	}()
+	return func() {
+		stopOnce.Do(func() {
+			close(stopped)
+		})
+	}
+}
+
+// publishHandoff sets data as the lock's data, logging instead of failing when it can't.
+func publishHandoff(ctx context.Context, h *mysqllocker.Handle, name string, data HandoffData, opts *handoffOpts) {
+	data.Since = time.Now()
+	err := h.SetData(ctx, data)
+	if err != nil {
+		opts.logf("guard: %s: could not publish handoff data: %v", name, err)
+	}
+}
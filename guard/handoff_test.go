@@ -0,0 +1,68 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestTakeOver(t *testing.T) {
+	t.Parallel()
+	appName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	table := "mysqllocker_test.handoff_" + fmt.Sprint(rand.Int63())
+	dataTable := mysqllocker.WithDataTable(table)
+	require.NoError(t, mysqllocker.EnsureSchema(ctx, db, mysqllocker.DefaultTableOptions, dataTable,
+		mysqllocker.WithAudit(table+"_audit"), mysqllocker.WithPreemptionTable(table+"_preempt")))
+
+	var logMux sync.Mutex
+	var logged []string
+	options := []HandoffOption{
+		WithHandoffLockOptions(dataTable),
+		WithHandoffWait(5 * time.Second),
+		WithHandoffLogger(func(format string, args ...interface{}) {
+			logMux.Lock()
+			logged = append(logged, fmt.Sprintf(format, args...))
+			logMux.Unlock()
+		}),
+	}
+	blue, err := TakeOver(ctx, db, appName, "blue", options...)
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, HandOff(ctx, blue, "blue", options...))
+	}()
+	green, err := TakeOver(ctx, db, appName, "green", options...)
+	require.NoError(t, err)
+	require.NoError(t, blue.Err())
+
+	raw, err := mysqllocker.GetLockData(ctx, db, SingleLockName(appName), dataTable)
+	require.NoError(t, err)
+	var data HandoffData
+	require.NoError(t, json.Unmarshal(raw, &data))
+	require.Equal(t, "green", data.Owner)
+	require.Equal(t, HandoffActive, data.State)
+	require.Equal(t, "blue", data.Previous)
+	require.NoError(t, green.Release())
+
+	logMux.Lock()
+	defer logMux.Unlock()
+	log := strings.Join(logged, "\n")
+	require.Contains(t, log, "green waiting for blue (active) to hand over")
+	require.Contains(t, log, "blue released for handoff")
+	require.Contains(t, log, "green took over after")
+}
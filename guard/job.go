@@ -0,0 +1,138 @@
+package guard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// ErrSkipped is wrapped by the error from a skipped run when FailSkipped is set.
+var ErrSkipped = errors.New("another node holds the lock")
+
+// JobLockName returns the name of the lock WrapJob uses for a job named name.
+func JobLockName(name string) string {
+	return mysqllocker.Name("guard", "job", name).String()
+}
+
+type jobOpts struct {
+	onSkip      func(name string)
+	failSkipped bool
+	lockOptions []mysqllocker.LockOption
+}
+
+// JobOption is an optional value for WrapJob and WrapTask
+type JobOption func(*jobOpts)
+
+// OnSkip sets a function for WrapJob to call with the job's name, or for WrapTask to call with the task's key, when a
+// run is skipped because another node holds the lock.
+func OnSkip(f func(name string)) JobOption {
+	return func(o *jobOpts) {
+		o.onSkip = f
+	}
+}
+
+// FailSkipped makes skipped runs return an error wrapping ErrSkipped instead of nil. Task queues that retry failed
+// tasks will then re-enqueue a duplicate task instead of dropping it.
+func FailSkipped() JobOption {
+	return func(o *jobOpts) {
+		o.failSkipped = true
+	}
+}
+
+// WithJobLockOptions sets options for the job's or task's lock.
+func WithJobLockOptions(options ...mysqllocker.LockOption) JobOption {
+	return func(o *jobOpts) {
+		o.lockOptions = append(o.lockOptions, options...)
+	}
+}
+
+// WrapJob wraps a scheduled job so each run only executes on the node that gets the job's lock. Runs on other nodes
+// are skipped and return nil. The context passed to job is canceled if the lock is lost.
+//
+// To use it with a scheduler that takes a func(), such as github.com/robfig/cron:
+//
+//	run := guard.WrapJob(db, "nightly-report", report)
+//	c.AddFunc("@daily", func() {
+//		if err := run(context.Background()); err != nil {
+//			log.Print(err)
+//		}
+//	})
+func WrapJob(db *sql.DB, name string, job func(ctx context.Context) error, options ...JobOption) func(ctx context.Context) error {
+	opts := &jobOpts{}
+	for _, o := range options {
+		o(opts)
+	}
+	lockName := JobLockName(name)
+	return func(ctx context.Context) error {
+		return runLocked(ctx, db, lockName, name, job, opts)
+	}
+}
+
+// TaskLockName returns the name of the lock WrapTask uses for a task with key.
+func TaskLockName(key string) string {
+	return mysqllocker.Name("guard", "task", key).String()
+}
+
+// WrapTask wraps a task queue handler so tasks with the same key aren't processed at the same time across workers.
+// key returns a task's uniqueness key, such as its type and payload. A task whose key is locked by another worker is
+// skipped and returns nil, or an error wrapping ErrSkipped with FailSkipped so the queue retries it later. The
+// context passed to handler is canceled if the lock is lost.
+//
+// It fits handlers that take a context and a task, like github.com/hibiken/asynq:
+//
+//	mux.HandleFunc("email:send", guard.WrapTask(db, func(t *asynq.Task) string {
+//		return t.Type() + ":" + string(t.Payload())
+//	}, sendEmail, guard.FailSkipped()))
+//
+// Libraries that call task functions with their own arguments, like github.com/RichardKnoop/machinery, can wrap a
+// closure over the arguments instead:
+//
+//	func SendEmail(ctx context.Context, to string) error {
+//		return guard.WrapTask(db, func(to string) string { return "email:" + to }, sendEmail)(ctx, to)
+//	}
+func WrapTask[T any](db *sql.DB, key func(task T) string, handler func(ctx context.Context, task T) error, options ...JobOption) func(ctx context.Context, task T) error {
+	opts := &jobOpts{}
+	for _, o := range options {
+		o(opts)
+	}
+	return func(ctx context.Context, task T) error {
+		k := key(task)
+		return runLocked(ctx, db, TaskLockName(k), k, func(ctx context.Context) error {
+			return handler(ctx, task)
+		}, opts)
+	}
+}
+
+// runLocked runs f while holding lockName, or skips it when another node holds the lock. name is passed to OnSkip.
+func runLocked(ctx context.Context, db *sql.DB, lockName, name string, f func(ctx context.Context) error, opts *jobOpts) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lockOptions := append(opts.lockOptions[:len(opts.lockOptions):len(opts.lockOptions)], mysqllocker.WithNoWait())
+	h, err := mysqllocker.Acquire(ctx, db, lockName, lockOptions...)
+	if err != nil {
+		busy, busyErr := isUsed(ctx, db, lockName)
+		if busyErr != nil || !busy {
+			return err
+		}
+		if opts.onSkip != nil {
+			opts.onSkip(name)
+		}
+		if opts.failSkipped {
+			return fmt.Errorf("%s: %w", name, ErrSkipped)
+		}
+		return nil
+	}
+	go func() {
+		<-h.Done()
+		cancel()
+	}()
+	err = f(ctx)
+	releaseErr := h.Release()
+	if err == nil {
+		err = releaseErr
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWrapJob(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	var runs int
+	var skipped []string
+	var run func(ctx context.Context) error
+	run = WrapJob(db, t.Name(), func(ctx context.Context) error {
+		runs++
+		// a run on another node while this one holds the lock is skipped
+		return run(ctx)
+	}, OnSkip(func(name string) {
+		skipped = append(skipped, name)
+	}))
+	require.NoError(t, run(ctx))
+	require.Equal(t, 1, runs)
+	require.Equal(t, []string{t.Name()}, skipped)
+}
+
+func TestWrapJobDeadline(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	// a deadline doesn't make a duplicate run wait for the lock
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	start := time.Now()
+	var runs int
+	var run func(ctx context.Context) error
+	run = WrapJob(db, t.Name(), func(ctx context.Context) error {
+		runs++
+		return run(ctx)
+	}, FailSkipped())
+	require.True(t, errors.Is(run(ctx), ErrSkipped))
+	require.Equal(t, 1, runs)
+
+	var handle func(ctx context.Context, key string) error
+	handle = WrapTask(db, func(key string) string {
+		return key
+	}, func(ctx context.Context, key string) error {
+		runs++
+		return handle(ctx, key)
+	}, FailSkipped())
+	require.True(t, errors.Is(handle(ctx, t.Name()), ErrSkipped))
+	require.Equal(t, 2, runs)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestTaskLockNameLength(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	key := t.Name() + ":" + strings.Repeat("payload", 20)
+	for _, name := range []string{TaskLockName(key), JobLockName(key), SingleLockName(key)} {
+		require.LessOrEqual(t, len(name), mysqllocker.MaxLockNameLength)
+	}
+	require.NotEqual(t, TaskLockName(key), TaskLockName(key+"2"))
+
+	var runs int
+	handle := WrapTask(db, func(key string) string {
+		return key
+	}, func(ctx context.Context, key string) error {
+		runs++
+		return nil
+	})
+	require.NoError(t, handle(ctx, key))
+	require.Equal(t, 1, runs)
+}
+
+func TestWrapTask(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	type task struct {
+		id   string
+		next *task
+	}
+	var runs []string
+	var handle func(ctx context.Context, tk *task) error
+	handle = WrapTask(db, func(tk *task) string {
+		return t.Name() + ":" + tk.id
+	}, func(ctx context.Context, tk *task) error {
+		runs = append(runs, tk.id)
+		if tk.next != nil {
+			return handle(ctx, tk.next)
+		}
+		return nil
+	}, FailSkipped())
+
+	// a different key runs while the first is held
+	require.NoError(t, handle(ctx, &task{id: "a", next: &task{id: "b"}}))
+	require.Equal(t, []string{"a", "b"}, runs)
+
+	// a duplicate of a running task is skipped
+	err := handle(ctx, &task{id: "a", next: &task{id: "a"}})
+	require.True(t, errors.Is(err, ErrSkipped))
+	require.Equal(t, []string{"a", "b", "a"}, runs)
+}
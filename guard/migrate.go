@@ -0,0 +1,53 @@
+package guard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// MigrationLockName is the name of the lock Migrate holds while migrations run.
+const MigrationLockName = "guard/migrations"
+
+// DefaultMigrationTimeout is how long Migrate waits for another node's migrations by default.
+const DefaultMigrationTimeout = 5 * time.Minute
+
+// ErrMigrationInProgress is returned by Migrate when another node is still running migrations after the timeout.
+var ErrMigrationInProgress = errors.New("another node is running migrations")
+
+// Migrate runs migrate while holding MigrationLockName so nodes sharing db never run schema migrations at the same
+// time. It works with any migration tool, for example:
+//
+//	err := guard.Migrate(ctx, db, func(ctx context.Context) error {
+//		return m.Up() // golang-migrate
+//	})
+//
+// It waits up to DefaultMigrationTimeout for another node's migrations to finish and then returns
+// ErrMigrationInProgress. Pass mysqllocker.WithTimeout to wait a different amount of time. The context passed to
+// migrate is canceled if the lock is lost.
+func Migrate(ctx context.Context, db *sql.DB, migrate func(ctx context.Context) error, options ...mysqllocker.LockOption) error {
+	options = append([]mysqllocker.LockOption{mysqllocker.WithTimeout(DefaultMigrationTimeout)}, options...)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h, err := mysqllocker.Acquire(ctx, db, MigrationLockName, options...)
+	if err != nil {
+		busy, busyErr := isUsed(ctx, db, MigrationLockName)
+		if busyErr == nil && busy {
+			return ErrMigrationInProgress
+		}
+		return err
+	}
+	go func() {
+		<-h.Done()
+		cancel()
+	}()
+	err = migrate(ctx)
+	releaseErr := h.Release()
+	if err == nil {
+		err = releaseErr
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package guard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestMigrate(t *testing.T) {
+	db := testdb.DB(t)
+	ctx := context.Background()
+	ran := false
+	err := Migrate(ctx, db, func(ctx context.Context) error {
+		err := Migrate(ctx, db, func(context.Context) error {
+			t.Error("nested migration should not run")
+			return nil
+		}, mysqllocker.WithTimeout(10*time.Millisecond))
+		require.Equal(t, ErrMigrationInProgress, err)
+		ran = true
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, ran)
+}
@@ -0,0 +1,128 @@
+package guard
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// DefaultOnceTable is the table DoOnce records completed keys in when WithOnceTable isn't set.
+const DefaultOnceTable = "guard_once"
+
+// DefaultOnceTimeout is how long DoOnce waits for another node running the same key by default.
+const DefaultOnceTimeout = 5 * time.Minute
+
+// OnceLockName returns the name of the lock DoOnce holds while running key.
+func OnceLockName(key string) string {
+	return mysqllocker.Name("guard", "once", key).String()
+}
+
+type onceOpts struct {
+	table       string
+	lockOptions []mysqllocker.LockOption
+}
+
+// OnceOption is an optional value for DoOnce
+type OnceOption func(*onceOpts)
+
+// WithOnceTable sets the table DoOnce records completed keys in. table is used in queries as-is, so it may be
+// qualified with a database name. Default is DefaultOnceTable.
+func WithOnceTable(table string) OnceOption {
+	return func(o *onceOpts) {
+		o.table = table
+	}
+}
+
+// WithOnceLockOptions sets options for the key's lock. Pass mysqllocker.WithTimeout to wait for another node
+// running the same key for something other than DefaultOnceTimeout.
+func WithOnceLockOptions(options ...mysqllocker.LockOption) OnceOption {
+	return func(o *onceOpts) {
+		o.lockOptions = append(o.lockOptions, options...)
+	}
+}
+
+// DoOnce runs fn once for key across every node using db, for one-time work like seeding data or a one-off
+// backfill. It holds the key's lock, skips fn when the key is already recorded as done and records it as done when
+// fn succeeds. When fn fails, nothing is recorded and a later call runs it again. A node calling DoOnce while another
+// runs the same key waits for it and then skips fn.
+//
+// Completed keys are rows in a table. The table must already exist, such as from EnsureOnceSchema, with at least
+// these columns:
+//
+//	CREATE TABLE guard_once (
+//	  once_key VARCHAR(255) NOT NULL PRIMARY KEY,
+//	  completed_at DATETIME(6) NOT NULL
+//	)
+//
+// The context passed to fn is canceled if the lock is lost, and the key isn't recorded then.
+func DoOnce(ctx context.Context, db *sql.DB, key string, fn func(ctx context.Context) error, options ...OnceOption) error {
+	opts := newOnceOpts(options)
+	lockOptions := append([]mysqllocker.LockOption{mysqllocker.WithTimeout(DefaultOnceTimeout)}, opts.lockOptions...)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h, err := mysqllocker.Acquire(ctx, db, OnceLockName(key), lockOptions...)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-h.Done()
+		cancel()
+	}()
+	err = doOnce(ctx, db, h, key, fn, opts.table)
+	releaseErr := h.Release()
+	if err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+// doOnce runs fn and records key unless key is already recorded. The caller holds key's lock with h.
+func doOnce(ctx context.Context, db *sql.DB, h *mysqllocker.Handle, key string, fn func(ctx context.Context) error, table string) error {
+	var done bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE once_key = ?)`, table), key).
+		Scan(&done)
+	if err != nil || done {
+		return err
+	}
+	err = fn(ctx)
+	if err != nil {
+		return err
+	}
+	// don't record work done after the lock was lost, since another node may be doing it too
+	err = h.Touch(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (once_key, completed_at) VALUES (?, NOW(6))`, table), key)
+	return err
+}
+
+// OnceSchemaSQL returns the CREATE TABLE statement for DoOnce's table with tableOptions, such as
+// "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", after it. It is for teams that manage DDL through their own migrations
+// instead of EnsureOnceSchema.
+func OnceSchemaSQL(tableOptions string, options ...OnceOption) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  once_key VARCHAR(255) NOT NULL PRIMARY KEY,
+  completed_at DATETIME(6) NOT NULL
+) %s`, newOnceOpts(options).table, tableOptions)
+}
+
+// EnsureOnceSchema creates DoOnce's table with the statement from OnceSchemaSQL and mysqllocker.DefaultTableOptions
+// if it doesn't exist. Pass it the same WithOnceTable option as DoOnce.
+func EnsureOnceSchema(ctx context.Context, db *sql.DB, options ...OnceOption) error {
+	_, err := db.ExecContext(ctx, OnceSchemaSQL(mysqllocker.DefaultTableOptions, options...))
+	return err
+}
+
+func newOnceOpts(options []OnceOption) *onceOpts {
+	opts := &onceOpts{
+		table: DefaultOnceTable,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
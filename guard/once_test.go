@@ -0,0 +1,38 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestDoOnce(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	table := WithOnceTable("mysqllocker_test.once_" + fmt.Sprint(rand.Int63()))
+	require.NoError(t, EnsureOnceSchema(ctx, db, table))
+
+	var runs int
+	failing := errors.New("failing")
+	err = DoOnce(ctx, db, t.Name(), func(ctx context.Context) error {
+		runs++
+		return failing
+	}, table)
+	require.Equal(t, failing, err)
+	for i := 0; i < 2; i++ {
+		err = DoOnce(ctx, db, t.Name(), func(ctx context.Context) error {
+			runs++
+			return nil
+		}, table)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, runs)
+}
@@ -0,0 +1,102 @@
+// Package guard provides helpers built on mysqllocker for code that must only run on one node at a time.
+package guard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// ErrAlreadyRunning is returned by Single when another instance holds the application's lock.
+var ErrAlreadyRunning = errors.New("another instance is already running")
+
+// SingleLockName returns the name of the lock Single uses for appName.
+func SingleLockName(appName string) string {
+	return mysqllocker.Name("guard", "single", appName).String()
+}
+
+type singleOpts struct {
+	wait        bool
+	onBusy      func()
+	exitCode    int
+	exit        bool
+	lockOptions []mysqllocker.LockOption
+}
+
+// SingleOption is an optional value for Single
+type SingleOption func(*singleOpts)
+
+// Wait makes Single block until the other instance releases the lock instead of returning ErrAlreadyRunning.
+func Wait() SingleOption {
+	return func(o *singleOpts) {
+		o.wait = true
+	}
+}
+
+// OnBusy sets a function for Single to call when another instance is already running.
+func OnBusy(f func()) SingleOption {
+	return func(o *singleOpts) {
+		o.onBusy = f
+	}
+}
+
+// ExitOnBusy makes Single print a message to stderr and exit the process with code when another instance is already
+// running.
+func ExitOnBusy(code int) SingleOption {
+	return func(o *singleOpts) {
+		o.exit = true
+		o.exitCode = code
+	}
+}
+
+// WithLockOptions sets options for the lock.
+func WithLockOptions(options ...mysqllocker.LockOption) SingleOption {
+	return func(o *singleOpts) {
+		o.lockOptions = append(o.lockOptions, options...)
+	}
+}
+
+// Single makes sure only one instance of appName runs across every process using db, like a cluster-wide flock(1).
+// It gets the lock named SingleLockName(appName) and holds it until ctx is canceled.
+// When another instance holds the lock, it returns an error wrapping ErrAlreadyRunning unless Wait, OnBusy or
+// ExitOnBusy say otherwise.
+func Single(ctx context.Context, db *sql.DB, appName string, options ...SingleOption) (*mysqllocker.Handle, error) {
+	opts := &singleOpts{}
+	for _, o := range options {
+		o(opts)
+	}
+	lockName := SingleLockName(appName)
+	lockOptions := opts.lockOptions
+	if opts.wait {
+		lockOptions = append(lockOptions[:len(lockOptions):len(lockOptions)], mysqllocker.WithTimeout(-1))
+	} else {
+		lockOptions = append(lockOptions[:len(lockOptions):len(lockOptions)], mysqllocker.WithNoWait())
+	}
+	h, err := mysqllocker.Acquire(ctx, db, lockName, lockOptions...)
+	if err == nil {
+		return h, nil
+	}
+	busy, busyErr := isUsed(ctx, db, lockName)
+	if busyErr != nil || !busy {
+		return nil, err
+	}
+	if opts.onBusy != nil {
+		opts.onBusy()
+	}
+	if opts.exit {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", appName, ErrAlreadyRunning)
+		os.Exit(opts.exitCode)
+	}
+	return nil, fmt.Errorf("%s: %w", appName, ErrAlreadyRunning)
+}
+
+// isUsed returns whether another session holds lockName.
+func isUsed(ctx context.Context, db *sql.DB, lockName string) (bool, error) {
+	var used bool
+	err := db.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?) IS NOT NULL`, lockName).Scan(&used)
+	return used, err
+}
@@ -0,0 +1,53 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestSingle(t *testing.T) {
+	t.Parallel()
+	appName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := Single(ctx, db, appName)
+	require.NoError(t, err)
+
+	var busy bool
+	_, err = Single(ctx, db, appName, OnBusy(func() {
+		busy = true
+	}))
+	require.True(t, errors.Is(err, ErrAlreadyRunning))
+	require.True(t, busy)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, h.Release())
+	}()
+	h2, err := Single(ctx, db, appName, Wait())
+	require.NoError(t, err)
+	require.NoError(t, h2.Release())
+}
+
+func TestSingleDeadline(t *testing.T) {
+	t.Parallel()
+	appName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	h, err := Single(ctx, db, appName)
+	require.NoError(t, err)
+	defer h.Release() //nolint:errcheck
+
+	// a deadline doesn't make Single wait without Wait
+	start := time.Now()
+	_, err = Single(ctx, db, appName)
+	require.True(t, errors.Is(err, ErrAlreadyRunning))
+	require.Less(t, time.Since(start), 10*time.Second)
+}
@@ -0,0 +1,547 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Handle is a lock obtained by Acquire.
+type Handle struct {
+	lockName string
+	db       *sql.DB
+	opts     *lockOpts
+	conn     *sql.Conn
+	// connectionID is the mysql connection id of conn. It is only set when auditing or sending events.
+	connectionID int64
+	// token is stored in the @mysqllocker_token session variable to tell this session from a new one with the same
+	// connection id.
+	token string
+	// connMux keeps the hold loop from using conn while a Tx is open. Reentrant handles share it.
+	connMux *sync.Mutex
+	// stmts are the prepared check and release statements. They are guarded by connMux and shared like connMux.
+	stmts *lockStmts
+	// released is set when the lock has been released. It is guarded by connMux. Use isReleased to include the
+	// shared lock's state for reentrant handles.
+	released bool
+	done     chan struct{}
+	err      error
+	// ownedDB is closed after the lock is released
+	ownedDB    *sql.DB
+	acquiredAt time.Time
+	// epoch is the process-wide acquisition count when the lock was acquired
+	epoch int64
+	// lastRenewal is the unix nano time of the last successful check. Reentrant handles share it.
+	lastRenewal *int64
+	// uncertain is 1 while the last check was slower than WithRenewalSLO allows. Reentrant handles share it.
+	uncertain *int32
+	// state is the state while the lock is held. Reentrant handles share it.
+	state *lockState
+	// subs are the channels of running Events iterators. Reentrant handles share them.
+	subs *eventSubs
+	// ended is StateLost or StateReleased once the Handle is done and zero before that
+	ended lockState
+	// shared is the Handle holding the lock for reentrant handles and nil otherwise
+	shared *Handle
+	// cancel stops holding the lock
+	cancel context.CancelFunc
+	// hooksMux guards onRelease and hooksRun
+	hooksMux  sync.Mutex
+	onRelease []func(ctx context.Context)
+	hooksRun  bool
+}
+
+var _ io.Closer = (*Handle)(nil)
+
+// Acquire gets a named lock from mysql using GET_LOCK() and holds it until ctx is canceled.
+// It checks that the lock is still held at a regular interval, which also keeps the connection from timing out.
+// If the lock is unavailable and "WithTimeout" is set, it will continue trying until it either times out or obtains a lock.
+func Acquire(ctx context.Context, db *sql.DB, lockName string, options ...LockOption) (*Handle, error) {
+	opts := newLockOpts(options)
+	if opts.reentrant {
+		return acquireReentrant(ctx, ctx, db, lockName, opts)
+	}
+	h, err := acquire(ctx, db, lockName, opts)
+	if err != nil {
+		return nil, err
+	}
+	h.start(ctx)
+	return h, nil
+}
+
+// AcquireDetached is like Acquire except that the lock is held until Release is called instead of until a context
+// is canceled. ctx is only used while getting the lock. This suits long-lived daemons that don't otherwise have a
+// context for the lock's lifetime.
+func AcquireDetached(ctx context.Context, db *sql.DB, lockName string, options ...LockOption) (*Handle, error) {
+	opts := newLockOpts(options)
+	if opts.reentrant {
+		return acquireReentrant(ctx, context.Background(), db, lockName, opts)
+	}
+	h, err := acquire(ctx, db, lockName, opts)
+	if err != nil {
+		return nil, err
+	}
+	h.start(context.Background())
+	return h, nil
+}
+
+// acquire gets the lock for a Handle without starting the hold loop. Transient errors are retried as set by
+// WithRetry.
+func acquire(ctx context.Context, db *sql.DB, lockName string, opts *lockOpts) (*Handle, error) {
+	for attempt := 1; ; attempt++ {
+		h, err := acquireOnce(ctx, db, lockName, opts)
+		if err == nil || attempt > opts.retries || !IsTransient(err) {
+			return h, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(opts.retryBackoff):
+		}
+	}
+}
+
+// acquireOnce makes one attempt at getting the lock for a Handle.
+func acquireOnce(ctx context.Context, db *sql.DB, lockName string, opts *lockOpts) (*Handle, error) {
+	counters := opts.countersFor(lockName)
+	counters.attempt()
+	if recentlyHeld(ctx, db, lockName, opts) {
+		counters.contend()
+		return nil, ErrRecentlyHeld
+	}
+	conn, err := getConn(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range opts.sessionInit {
+		_, err = conn.ExecContext(ctx, stmt)
+		if err != nil {
+			_ = conn.Close() //nolint:errcheck
+			return nil, fmt.Errorf("could not initialize session: %w", err)
+		}
+	}
+
+	var previousOwner, connectionID int64
+	if opts.auditTable != "" || len(opts.eventSinks) > 0 {
+		row := conn.QueryRowContext(ctx, `SELECT COALESCE(IS_USED_LOCK(?), 0), CONNECTION_ID()`, lockName)
+		err = row.Scan(&previousOwner, &connectionID)
+		if err != nil {
+			_ = conn.Close() //nolint:errcheck
+			return nil, fmt.Errorf("could not obtain lock: %w", err)
+		}
+	}
+
+	withdraw, err := requestPreemption(ctx, conn, lockName, opts)
+	if err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return nil, fmt.Errorf("could not request preemption: %w", err)
+	}
+	ok, err := false, opts.fault(FaultAcquire)
+	if err == nil && opts.hierarchical {
+		ok, err = getHierarchicalLock(ctx, conn, lockName, opts)
+	} else if err == nil {
+		ok, err = getLock(ctx, conn, lockName, opts)
+	}
+	withdraw()
+	if err != nil {
+		_ = conn.Close() //nolint:errcheck
+		if errors.Is(err, context.DeadlineExceeded) {
+			counters.contend()
+			if bErr := blockedError(db, lockName, opts, err); bErr != nil {
+				return nil, bErr
+			}
+		}
+		return nil, fmt.Errorf("could not obtain lock: %w", err)
+	}
+	setContested(db, lockName, opts, !ok)
+	if !ok {
+		counters.contend()
+		_ = conn.Close() //nolint:errcheck
+		timeoutErr := &TimeoutError{LockName: lockName}
+		if bErr := blockedError(db, lockName, opts, timeoutErr); bErr != nil {
+			return nil, bErr
+		}
+		return nil, fmt.Errorf("could not obtain lock: %w", timeoutErr)
+	}
+	stmts := &lockStmts{releaseAll: opts.releaseAll}
+	token, err := newOwnerToken()
+	if err == nil {
+		err = setOwner(ctx, conn, token, opts.owner())
+	}
+	if err == nil {
+		stmts.restoreSession, err = configureSession(ctx, conn, opts)
+	}
+	if err != nil {
+		_ = releaseLock(conn, lockName, opts, stmts) //nolint:errcheck
+		return nil, fmt.Errorf("could not obtain lock: %w", err)
+	}
+	h := &Handle{
+		lockName:     lockName,
+		db:           db,
+		opts:         opts,
+		conn:         conn,
+		connectionID: connectionID,
+		token:        token,
+		connMux:      &sync.Mutex{},
+		stmts:        stmts,
+		done:         make(chan struct{}),
+		acquiredAt:   time.Now(),
+		lastRenewal:  new(int64),
+		uncertain:    new(int32),
+		subs:         &eventSubs{},
+	}
+	h.state = newLockState(StateHeld, h.acquiredAt)
+	h.epoch = recordAcquired()
+	event := EventAcquire
+	if previousOwner != 0 {
+		event = EventTakeover
+	}
+	h.emit(conn, event, nil)
+	return h, nil
+}
+
+// Name returns the name of the lock.
+func (h *Handle) Name() string {
+	return h.lockName
+}
+
+// LockInfo describes a held lock.
+type LockInfo struct {
+	Name       string
+	AcquiredAt time.Time
+	// LastRenewal is when a regular check last succeeded. It is zero before the first check.
+	LastRenewal time.Time
+	// Epoch increases with every lock acquired in this process, so a later acquisition of the same name has a larger
+	// Epoch.
+	Epoch int64
+	// OwnerID is the WithOwnerID value.
+	OwnerID string
+}
+
+// Info returns a description of the lock.
+func (h *Handle) Info() LockInfo {
+	info := LockInfo{
+		Name:       h.lockName,
+		AcquiredAt: h.acquiredAt,
+		Epoch:      h.epoch,
+		OwnerID:    h.opts.owner(),
+	}
+	if renewed := atomic.LoadInt64(h.lastRenewal); renewed != 0 {
+		info.LastRenewal = time.Unix(0, renewed)
+	}
+	return info
+}
+
+// Done returns a channel that is closed when the lock is released.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error that caused the lock to be released. It returns nil until Done is closed and when the lock
+// was released because ctx was canceled or its deadline passed. When ctx was canceled with a cause, such as with
+// context.WithCancelCause, it returns the cause. It is a *LostError when another session took the lock or a
+// *ConnError when the lock's connection failed.
+func (h *Handle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// BeginTx starts a transaction on the connection holding the lock, so the transaction and the lock share a session.
+// The lock isn't checked and can't be released while the transaction is open, so Commit or Rollback
+// must always be called.
+func (h *Handle) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	h.connMux.Lock()
+	tx, err := h.conn.BeginTx(ctx, opts)
+	if err != nil {
+		h.connMux.Unlock()
+		return nil, err
+	}
+	var once sync.Once
+	return &Tx{
+		Tx: tx,
+		unlock: func() {
+			once.Do(h.connMux.Unlock)
+		},
+	}, nil
+}
+
+// Conn calls f with the connection holding the lock so it can run session-scoped statements such as SET,
+// user variables and temporary tables. The lock isn't checked while f is running. f must not close conn,
+// and the lock will be lost if f releases it or changes @mysqllocker_token.
+func (h *Handle) Conn(f func(conn *sql.Conn) error) error {
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	return f(h.conn)
+}
+
+// Touch checks that the lock is still held right away instead of waiting for the next regular check, so callers
+// can verify the lock immediately before doing something that is only safe while holding it.
+// It returns a *LostError when the lock is held by another session or has been released, and a *ConnError when the
+// check fails. A failed Touch doesn't release the lock. The regular checks decide that.
+func (h *Handle) Touch(ctx context.Context) error {
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	select {
+	case <-h.done:
+		return &LostError{LockName: h.lockName}
+	default:
+	}
+	if h.isReleased() {
+		return &LostError{LockName: h.lockName}
+	}
+	return h.check(ctx, true)
+}
+
+// check checks that the lock is held. When full is false, it only pings the connection. The caller must hold connMux.
+func (h *Handle) check(ctx context.Context, full bool) error {
+	if err := h.opts.fault(FaultCheck); err != nil {
+		if _, ok := err.(*LostError); ok {
+			return err
+		}
+		return &ConnError{LockName: h.lockName, Err: err}
+	}
+	if !full {
+		err := h.conn.PingContext(ctx)
+		if err != nil {
+			return &ConnError{LockName: h.lockName, Err: err}
+		}
+		return nil
+	}
+	err := h.stmts.prepare(ctx, h.conn, h.lockName, h.opts)
+	if err != nil {
+		return &ConnError{LockName: h.lockName, Err: err}
+	}
+	err = checkLock(ctx, h.stmts.check, h.lockName, h.token)
+	if err != nil || h.opts.renewalCheck == nil {
+		return err
+	}
+	err = h.opts.renewalCheck(ctx, h.conn)
+	if err != nil {
+		return &CheckError{LockName: h.lockName, Err: err}
+	}
+	return nil
+}
+
+// renew runs a regular check bounded by the WithRenewTimeout deadline.
+func (h *Handle) renew(ctx context.Context, full bool) error {
+	if h.opts.renewTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.renewTimeout)
+		defer cancel()
+	}
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	return h.check(ctx, full)
+}
+
+// Release releases the lock and returns the error that ended it, like Err. It is safe to call more than once, and
+// calls after the first return the same error.
+func (h *Handle) Release() error {
+	h.cancel()
+	<-h.done
+	return h.err
+}
+
+// Close is the same as Release. It lets Handle be used as an io.Closer.
+func (h *Handle) Close() error {
+	return h.Release()
+}
+
+// start holds the lock in the background until ctx is canceled or Close is called.
+func (h *Handle) start(ctx context.Context) {
+	ctx, h.cancel = context.WithCancel(ctx)
+	goHold(ctx, h.lockName, h.hold)
+}
+
+// hold checks the lock until ctx is done or the lock is lost, then releases the lock.
+func (h *Handle) hold(ctx context.Context) {
+	interval := h.opts.clampPingInterval(h.opts.pingInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var alarm <-chan time.Time
+	if h.opts.holdAlarm > 0 && h.opts.holdAlarmFunc != nil {
+		alarmTicker := time.NewTicker(h.opts.holdAlarm)
+		defer alarmTicker.Stop()
+		alarm = alarmTicker.C
+	}
+	var expired <-chan time.Time
+	if h.opts.maxHold > 0 {
+		expiry := time.NewTimer(h.opts.maxHold - time.Since(h.acquiredAt))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+	var lErr error
+	var ticks, failures int
+	var failingSince time.Time
+	var preemptSeen string
+	for lErr == nil {
+		select {
+		case <-ctx.Done():
+			lErr = ctx.Err()
+		case <-alarm:
+			h.opts.holdAlarmFunc(h.Info())
+		case <-expired:
+			lErr = ErrMaxHold
+		case <-ticker.C:
+			ticks++
+			full := h.opts.checkEvery <= 1 || ticks%h.opts.checkEvery == 0
+			start := time.Now()
+			err := h.renew(ctx, full)
+			latency := time.Since(start)
+			if next := h.opts.nextPingInterval(interval, latency, err != nil); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+			if err == nil {
+				atomic.StoreInt64(h.lastRenewal, time.Now().UnixNano())
+				h.state.set(StateHeld)
+				h.opts.countersFor(h.lockName).renew()
+				h.checkLatency(latency)
+				preemptSeen = h.checkPreemption(ctx, preemptSeen)
+				failures = 0
+				break
+			}
+			if ctx.Err() != nil {
+				lErr = ctx.Err()
+				break
+			}
+			recordRenewalFailure()
+			h.state.set(StateRenewing)
+			switch err.(type) {
+			case *LostError, *CheckError:
+				lErr = err
+				continue
+			}
+			// a dead connection's session is gone along with its locks, so there is nothing to wait out
+			if isBadConn(err) {
+				lErr = err
+				continue
+			}
+			if failures == 0 {
+				failingSince = time.Now()
+			}
+			failures++
+			if h.opts.lostAfter(failures, time.Since(failingSince)) {
+				lErr = err
+			}
+		}
+	}
+	h.connMux.Lock()
+	injectedErr := h.opts.fault(FaultRelease)
+	releaseErr := ignoreErr(releaseLock(h.conn, h.lockName, h.opts, h.stmts))
+	if injectedErr != nil {
+		releaseErr = injectedErr
+	}
+	h.released = true
+	h.connMux.Unlock()
+	recordReleased(time.Since(h.acquiredAt))
+	if releaseErr != nil {
+		lErr = releaseErr
+	}
+	lost := ignoreErr(lErr) != nil
+	if lost {
+		h.opts.countersFor(h.lockName).lose()
+		h.emit(h.db, EventRenewFail, lErr)
+	} else {
+		h.emit(h.db, EventRelease, nil)
+	}
+	if h.ownedDB != nil {
+		closeErr := h.ownedDB.Close()
+		if lErr == nil {
+			lErr = closeErr
+		}
+	}
+	err := ignoreErr(lErr)
+	if err == nil && ctx.Err() != nil {
+		// a cancel cause is reported by Err, but the lock was released as asked, not lost
+		err = ignoreErr(context.Cause(ctx))
+	}
+	h.finish(err, lost)
+}
+
+// isReleased returns whether the lock has been released, including by the shared lock of a reentrant handle. The
+// caller must hold connMux.
+func (h *Handle) isReleased() bool {
+	return h.released || h.shared != nil && h.shared.released
+}
+
+// lost returns whether the lock ended because it was lost. It is false until Done is closed.
+func (h *Handle) lost() bool {
+	state, _ := h.ended.get()
+	return state == StateLost
+}
+
+// releaseHookTimeout bounds the context passed to OnRelease functions.
+const releaseHookTimeout = 10 * time.Second
+
+// OnRelease registers f to be called after the lock is released or lost, such as to flip a readiness gauge or tear
+// down resources that only make sense while holding the lock. Functions are called in the reverse of the order they
+// were registered, before Done is closed and Release returns, so they must not wait on either. Each gets a context
+// that expires after 10 seconds. If the lock has already been released, f is called immediately.
+func (h *Handle) OnRelease(f func(ctx context.Context)) {
+	h.hooksMux.Lock()
+	if !h.hooksRun {
+		h.onRelease = append(h.onRelease, f)
+		h.hooksMux.Unlock()
+		return
+	}
+	h.hooksMux.Unlock()
+	runReleaseHook(f)
+}
+
+// runReleaseHook calls an OnRelease function with a bounded context.
+func runReleaseHook(f func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseHookTimeout)
+	defer cancel()
+	f(ctx)
+}
+
+// finish runs the OnRelease functions, records the error that ended the lock, closes done and, when the lock was lost,
+// calls the WithErrorHandler handler.
+func (h *Handle) finish(err error, lost bool) {
+	if lost {
+		h.ended.set(StateLost)
+	} else {
+		h.ended.set(StateReleased)
+	}
+	h.hooksMux.Lock()
+	hooks := h.onRelease
+	h.onRelease = nil
+	h.hooksRun = true
+	h.hooksMux.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		runReleaseHook(hooks[i])
+	}
+	h.err = err
+	close(h.done)
+	if lost && h.opts.errorHandler != nil {
+		h.opts.errorHandler(err)
+	}
+}
+
+// Tx is a transaction started by Handle.BeginTx.
+type Tx struct {
+	*sql.Tx
+	unlock func()
+}
+
+// Commit commits the transaction.
+func (tx *Tx) Commit() error {
+	defer tx.unlock()
+	return tx.Tx.Commit()
+}
+
+// Rollback aborts the transaction.
+func (tx *Tx) Rollback() error {
+	defer tx.unlock()
+	return tx.Tx.Rollback()
+}
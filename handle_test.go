@@ -0,0 +1,502 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestHandle(t *testing.T) {
+	t.Run("releases when ctx is canceled", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		require.Equal(t, lockName, h.Name())
+		require.NoError(t, h.Err())
+		cancel()
+		<-h.Done()
+		require.NoError(t, h.Err())
+	})
+
+	t.Run("BeginTx", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		tx, err := h.BeginTx(ctx, nil)
+		require.NoError(t, err)
+		var sameSession bool
+		err = tx.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?) = CONNECTION_ID()`, lockName).Scan(&sameSession)
+		require.NoError(t, err)
+		require.True(t, sameSession)
+		require.NoError(t, tx.Commit())
+		require.Error(t, tx.Rollback())
+		cancel()
+		<-h.Done()
+		require.NoError(t, h.Err())
+	})
+
+	t.Run("Conn", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		err = h.Conn(func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `SET @mysqllocker_test = 1`)
+			return err
+		})
+		require.NoError(t, err)
+		var val int
+		err = h.Conn(func(conn *sql.Conn) error {
+			return conn.QueryRowContext(ctx, `SELECT @mysqllocker_test`).Scan(&val)
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, val)
+	})
+
+	t.Run("WithSessionInit", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithSessionInit(`SET SESSION wait_timeout = 1234`))
+		require.NoError(t, err)
+		var waitTimeout int
+		err = h.Conn(func(conn *sql.Conn) error {
+			return conn.QueryRowContext(ctx, `SELECT @@SESSION.wait_timeout`).Scan(&waitTimeout)
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1234, waitTimeout)
+
+		_, err = Acquire(ctx, db, lockName+"_bad", WithSessionInit(`SET SESSION not_a_variable = 1`))
+		require.Error(t, err)
+	})
+
+	t.Run("detects a lost lock", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithPingInterval(10*time.Millisecond))
+		require.NoError(t, err)
+		err = h.Conn(func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, lockName)
+			return err
+		})
+		require.NoError(t, err)
+		<-h.Done()
+		var lostErr *LostError
+		require.True(t, errors.As(h.Err(), &lostErr))
+		require.Equal(t, lockName, lostErr.LockName)
+		require.Zero(t, lostErr.Owner)
+	})
+
+	t.Run("ends on a closed connection", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithPingInterval(10*time.Millisecond), WithGracePeriod(time.Hour))
+		require.NoError(t, err)
+		err = h.Conn(func(conn *sql.Conn) error {
+			return conn.Close()
+		})
+		require.NoError(t, err)
+		select {
+		case <-h.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("handle kept waiting out the grace period on a closed connection")
+		}
+		var connErr *ConnError
+		require.True(t, errors.As(h.Err(), &connErr))
+		require.True(t, errors.Is(h.Err(), sql.ErrConnDone))
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		require.NoError(t, h.Touch(ctx))
+		err = h.Conn(func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, lockName)
+			return err
+		})
+		require.NoError(t, err)
+		var lostErr *LostError
+		require.True(t, errors.As(h.Touch(ctx), &lostErr))
+		cancel()
+		<-h.Done()
+		require.True(t, errors.As(h.Touch(context.Background()), &lostErr))
+	})
+
+	t.Run("detects a replaced owner token", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithPingInterval(10*time.Millisecond))
+		require.NoError(t, err)
+		err = h.Conn(func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `SET @mysqllocker_token = 'someone else'`)
+			return err
+		})
+		require.NoError(t, err)
+		<-h.Done()
+		var lostErr *LostError
+		require.True(t, errors.As(h.Err(), &lostErr))
+	})
+
+	t.Run("reuses prepared statements", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		require.NoError(t, h.Touch(ctx))
+		check := h.stmts.check
+		require.NotNil(t, check)
+		require.NoError(t, h.Touch(ctx))
+		require.Same(t, check, h.stmts.check)
+		require.NoError(t, h.Release())
+		require.Nil(t, h.stmts.check)
+	})
+
+	t.Run("WithRenewalCheck", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		readOnly := errors.New("read only")
+		h, err := Acquire(ctx, db, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithFailureThreshold(100),
+			WithRenewalCheck(func(ctx context.Context, conn *sql.Conn) error {
+				var n int
+				err := conn.QueryRowContext(ctx, `SELECT COALESCE(@mysqllocker_test_read_only, 0)`).Scan(&n)
+				if err == nil && n != 0 {
+					err = readOnly
+				}
+				return err
+			}),
+		)
+		require.NoError(t, err)
+		require.NoError(t, h.Touch(ctx))
+		err = h.Conn(func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `SET @mysqllocker_test_read_only = 1`)
+			return err
+		})
+		require.NoError(t, err)
+		<-h.Done()
+		var checkErr *CheckError
+		require.True(t, errors.As(h.Err(), &checkErr))
+		require.True(t, errors.Is(h.Err(), readOnly))
+	})
+
+	t.Run("State", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx := context.Background()
+		h, err := Acquire(ctx, db, lockName, WithPingInterval(10*time.Millisecond))
+		require.NoError(t, err)
+		state, since := h.State()
+		require.Equal(t, StateHeld, state)
+		require.Equal(t, h.Info().AcquiredAt, since)
+		require.Eventually(t, func() bool {
+			return !h.Info().LastRenewal.IsZero()
+		}, time.Second, time.Millisecond)
+		require.NoError(t, h.Release())
+		state, since = h.State()
+		require.Equal(t, StateReleased, state)
+		require.True(t, since.After(h.Info().AcquiredAt))
+
+		h, err = Acquire(ctx, db, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithFaults(func(point FaultPoint) error {
+				if point == FaultCheck {
+					return &LostError{LockName: lockName}
+				}
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		<-h.Done()
+		state, _ = h.State()
+		require.Equal(t, StateLost, state)
+		require.Equal(t, "lost", state.String())
+	})
+
+	t.Run("WithRenewalSLO", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var slow int64
+		events := make(chan Event, 100)
+		h, err := Acquire(ctx, db, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithRenewalSLO(20*time.Millisecond, 50*time.Millisecond),
+			WithEventSink(ChanSink(events)),
+			WithRenewalCheck(func(ctx context.Context, conn *sql.Conn) error {
+				time.Sleep(time.Duration(atomic.LoadInt64(&slow)))
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		require.Equal(t, EventAcquire, (<-events).Type)
+		require.False(t, h.Uncertain())
+
+		atomic.StoreInt64(&slow, int64(30*time.Millisecond))
+		event := <-events
+		require.Equal(t, EventSlowRenewal, event.Type)
+		require.GreaterOrEqual(t, event.Latency, 20*time.Millisecond)
+
+		atomic.StoreInt64(&slow, int64(60*time.Millisecond))
+		require.Eventually(t, h.Uncertain, time.Second, time.Millisecond)
+
+		atomic.StoreInt64(&slow, 0)
+		require.Eventually(t, func() bool {
+			return !h.Uncertain()
+		}, time.Second, time.Millisecond)
+		require.NoError(t, h.Release())
+	})
+
+	t.Run("WithHoldAlarm", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		alarms := make(chan LockInfo, 10)
+		h, err := Acquire(ctx, db, lockName, WithHoldAlarm(20*time.Millisecond, func(info LockInfo) {
+			alarms <- info
+		}))
+		require.NoError(t, err)
+		first := <-alarms
+		require.Equal(t, lockName, first.Name)
+		require.GreaterOrEqual(t, int64(time.Since(first.AcquiredAt)), int64(20*time.Millisecond))
+		// it repeats
+		<-alarms
+		require.NoError(t, h.Release())
+	})
+
+	t.Run("WithSessionTimeouts", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithSessionTimeouts(100*24*time.Hour, 0))
+		require.NoError(t, err)
+		var waitTimeout int64
+		err = h.Conn(func(conn *sql.Conn) error {
+			return conn.QueryRowContext(ctx, `SELECT @@SESSION.wait_timeout`).Scan(&waitTimeout)
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(100*24*60*60), waitTimeout)
+		require.NoError(t, h.Release())
+	})
+
+	t.Run("replaces a stale connection", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db, err := sql.Open("mysql", fmt.Sprintf("root:@tcp(%s)/", testdb.Addr(t)))
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, db.Close())
+		}()
+		db.SetMaxOpenConns(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var connectionID int64
+		require.NoError(t, db.QueryRowContext(ctx, `SELECT CONNECTION_ID()`).Scan(&connectionID))
+		// kill the idle pooled connection from another session
+		_, err = testdb.DB(t).ExecContext(ctx, `KILL ?`, connectionID)
+		require.NoError(t, err)
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		require.NoError(t, h.Release())
+	})
+
+	t.Run("WithCheckEvery", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName, WithPingInterval(10*time.Millisecond), WithCheckEvery(5))
+		require.NoError(t, err)
+		err = h.Conn(func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, lockName)
+			return err
+		})
+		require.NoError(t, err)
+		<-h.Done()
+		var lostErr *LostError
+		require.True(t, errors.As(h.Err(), &lostErr))
+	})
+
+	t.Run("WithRenewTimeout", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		h, err := Acquire(ctx, db, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithRenewTimeout(time.Nanosecond),
+			WithReleaseTimeout(time.Second),
+		)
+		require.NoError(t, err)
+		<-h.Done()
+		var connErr *ConnError
+		require.True(t, errors.As(h.Err(), &connErr))
+		require.True(t, errors.Is(h.Err(), context.DeadlineExceeded))
+	})
+
+	t.Run("reports cancel cause", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		var handled int32
+		locker := NewLocker(db, WithDefaults(WithErrorHandler(func(error) {
+			atomic.AddInt32(&handled, 1)
+		})))
+		h, err := locker.Acquire(ctx, lockName)
+		require.NoError(t, err)
+		errShutdown := errors.New("shutting down")
+		cancel(errShutdown)
+		<-h.Done()
+		require.Equal(t, errShutdown, h.Err())
+
+		// a cancel with a cause is a release, not a loss
+		state, _ := h.State()
+		require.Equal(t, StateReleased, state)
+		require.Zero(t, locker.Stats(lockName).Losses)
+		require.Zero(t, atomic.LoadInt32(&handled))
+	})
+
+	t.Run("WithErrorHandler", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		handled := make(chan error, 1)
+		_, err := Lock(ctx, db, lockName,
+			WithPingInterval(10*time.Millisecond),
+			WithErrorHandler(func(err error) {
+				handled <- err
+			}),
+			WithFaults(func(point FaultPoint) error {
+				if point == FaultCheck {
+					return &LostError{LockName: lockName}
+				}
+				return nil
+			}),
+		)
+		require.NoError(t, err)
+		var lostErr *LostError
+		require.True(t, errors.As(<-handled, &lostErr))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		h, err := Acquire(context.Background(), db, lockName)
+		require.NoError(t, err)
+		require.NoError(t, h.Close())
+		require.NoError(t, h.Close())
+		<-h.Done()
+		owner, err := GetLockOwner(context.Background(), db, lockName)
+		require.NoError(t, err)
+		require.Nil(t, owner)
+	})
+
+	t.Run("AcquireDetached", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		h, err := AcquireDetached(ctx, db, lockName, WithPingInterval(10*time.Millisecond))
+		require.NoError(t, err)
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+		require.NoError(t, h.Touch(context.Background()))
+		require.NoError(t, h.Release())
+		<-h.Done()
+	})
+
+	t.Run("ReleaseAll", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx := context.Background()
+		h, err := Acquire(ctx, db, lockName)
+		require.NoError(t, err)
+		require.NoError(t, h.Conn(func(conn *sql.Conn) error {
+			return conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, lockName+"/extra").Scan(new(int))
+		}))
+		require.NoError(t, h.ReleaseAll())
+		for _, name := range []string{lockName, lockName + "/extra"} {
+			owner, err := GetLockOwner(ctx, db, name)
+			require.NoError(t, err)
+			require.Nil(t, owner)
+		}
+	})
+
+	t.Run("OnRelease", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		h, err := Acquire(context.Background(), db, lockName)
+		require.NoError(t, err)
+		var calls []string
+		h.OnRelease(func(ctx context.Context) {
+			_, ok := ctx.Deadline()
+			require.True(t, ok)
+			calls = append(calls, "first")
+		})
+		h.OnRelease(func(context.Context) {
+			calls = append(calls, "second")
+		})
+		require.NoError(t, h.Release())
+		require.Equal(t, []string{"second", "first"}, calls)
+		h.OnRelease(func(context.Context) {
+			calls = append(calls, "late")
+		})
+		require.Equal(t, []string{"second", "first", "late"}, calls)
+	})
+}
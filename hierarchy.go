@@ -0,0 +1,137 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+const hierarchyRetryInterval = 100 * time.Millisecond
+
+// WithHierarchy treats the lock name as a path of parts separated by "/", like the names built by LockName, and makes
+// the lock conflict with its ancestors and descendants as well as itself:
+//
+//   - "tenant/42" can't be acquired while "tenant/42/reports" or "tenant/42/reports/7" is held.
+//   - "tenant/42/reports" can't be acquired while "tenant" or "tenant/42" is held with WithHierarchy.
+//   - Siblings such as "tenant/42/reports" and "tenant/42/billing" don't conflict.
+//
+// Ancestors are checked by briefly taking each ancestor's lock in order from the root before taking the lock itself,
+// so only ancestors held with WithHierarchy block descendants. Descendants are found in
+// performance_schema.metadata_locks, which needs the "wait/lock/metadata/sql/mdl" instrument enabled (the default
+// from MySQL 8.0), and any held descendant blocks its ancestors whether or not it was acquired with WithHierarchy.
+// Names shortened by LockName to fit MaxLockNameLength may not be recognized as descendants.
+func WithHierarchy() LockOption {
+	return func(o *lockOpts) {
+		o.hierarchical = true
+	}
+}
+
+// lockAncestors returns the ancestors of lockName from the root down.
+func lockAncestors(lockName string) []string {
+	parts := strings.Split(lockName, lockNameSeparator)
+	ancestors := make([]string, 0, len(parts)-1)
+	for i := 1; i < len(parts); i++ {
+		ancestors = append(ancestors, strings.Join(parts[:i], lockNameSeparator))
+	}
+	return ancestors
+}
+
+// getHierarchicalLock is getLock for WithHierarchy.
+func getHierarchicalLock(ctx context.Context, conn *sql.Conn, lockName string, opts *lockOpts) (bool, error) {
+	defer traceWait(ctx, lockName).End()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	if lockWait(ctx, opts) != 0 && opts.progress != nil && opts.progressInterval > 0 {
+		stop := reportProgress(opts.progressInterval, opts.progress)
+		defer stop()
+	}
+	// wait waits before retrying and returns false when the attempt shouldn't be retried
+	wait := func() (bool, error) {
+		if lockWait(ctx, opts) == 0 {
+			return false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(hierarchyRetryInterval):
+			return true, nil
+		}
+	}
+
+	// Take the ancestors' locks so no ancestor is held, then try the lock itself. Nothing is waited on while holding
+	// ancestors because that would block siblings, so waiting is done by retrying.
+	ancestors := lockAncestors(lockName)
+	for {
+		ok, err := passAncestors(ctx, conn, lockName, ancestors, opts)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			break
+		}
+		retry, err := wait()
+		if !retry {
+			return false, err
+		}
+	}
+
+	// wait for descendants to be released
+	for {
+		held, err := heldDescendants(ctx, conn, lockName)
+		if err == nil && !held {
+			return true, nil
+		}
+		retry := false
+		if err == nil {
+			retry, err = wait()
+		}
+		if !retry {
+			_, _ = conn.ExecContext(context.Background(), `DO RELEASE_LOCK(?)`, lockName) //nolint:errcheck
+			return false, err
+		}
+	}
+}
+
+// passAncestors takes the locks for ancestors and then lockName without waiting and releases the ancestors. It returns
+// false when any of them is held by another session.
+func passAncestors(ctx context.Context, conn *sql.Conn, lockName string, ancestors []string, opts *lockOpts) (ok bool, err error) {
+	taken := 0
+	defer func() {
+		for _, ancestor := range ancestors[:taken] {
+			_, releaseErr := conn.ExecContext(context.Background(), `DO RELEASE_LOCK(?)`, ancestor)
+			if err == nil {
+				err = releaseErr
+			}
+		}
+	}()
+	for _, ancestor := range ancestors {
+		var gotLock sql.NullBool
+		err = conn.QueryRowContext(ctx, opts.commented(ctx, lockName, `SELECT GET_LOCK(?, 0)`), ancestor).Scan(&gotLock)
+		ok, err = getLockResult(ancestor, gotLock, err)
+		if err != nil || !ok {
+			return false, err
+		}
+		taken++
+	}
+	var gotLock sql.NullBool
+	err = conn.QueryRowContext(ctx, opts.commented(ctx, lockName, `SELECT GET_LOCK(?, 0)`), lockName).Scan(&gotLock)
+	return getLockResult(lockName, gotLock, err)
+}
+
+// heldDescendants returns whether any descendant of lockName is held.
+func heldDescendants(ctx context.Context, conn *sql.Conn, lockName string) (bool, error) {
+	pattern := likeEscaper.Replace(lockName+lockNameSeparator) + "%"
+	var held bool
+	err := conn.QueryRowContext(ctx, `
+SELECT EXISTS(
+  SELECT 1 FROM performance_schema.metadata_locks
+  WHERE OBJECT_TYPE = 'USER LEVEL LOCK' AND LOCK_STATUS = 'GRANTED' AND OBJECT_NAME LIKE ?
+)`, pattern).Scan(&held)
+	return held, unsupported("WithHierarchy", err)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,95 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestLockAncestors(t *testing.T) {
+	require.Equal(t, []string{"a", "a/b"}, lockAncestors("a/b/c"))
+	require.Empty(t, lockAncestors("a"))
+}
+
+func enableMDLInstrument(t *testing.T) {
+	t.Helper()
+	_, err := testdb.DB(t).Exec(`
+UPDATE performance_schema.setup_instruments SET ENABLED = 'YES', TIMED = 'YES'
+WHERE NAME = 'wait/lock/metadata/sql/mdl'`)
+	require.NoError(t, err)
+}
+
+func TestWithHierarchy(t *testing.T) {
+	enableMDLInstrument(t)
+	root := Name(t.Name())
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	parent := root.Child("tenant", "42")
+	reports := parent.Child("reports")
+	billing := parent.Child("billing")
+
+	h, err := Acquire(ctx, db, reports.String(), WithHierarchy())
+	require.NoError(t, err)
+	_, err = Acquire(ctx, db, billing.String(), WithHierarchy())
+	require.NoError(t, err, "siblings shouldn't conflict")
+	_, err = Acquire(ctx, db, parent.String(), WithHierarchy())
+	require.Error(t, err, "parent should conflict with held children")
+
+	require.NoError(t, h.Release())
+	_, err = Acquire(ctx, db, parent.String(), WithHierarchy())
+	require.Error(t, err, "parent should conflict with the remaining child")
+
+	cancel()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	waitForFree(t, db, billing.String())
+	_, err = Acquire(ctx, db, parent.String(), WithHierarchy())
+	require.NoError(t, err)
+	_, err = Acquire(ctx, db, reports.Child("7").String(), WithHierarchy())
+	require.Error(t, err, "children should conflict with a held ancestor")
+
+	// a ctx deadline waits for the ancestor like a plain lock waits
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	h, err = Acquire(waitCtx, db, reports.Child("7").String(), WithHierarchy())
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+}
+
+func TestWithHierarchyWaitingBlocksNoSiblings(t *testing.T) {
+	enableMDLInstrument(t)
+	parent := Name(t.Name(), "tenant")
+	db := testdb.DB(t)
+	ctx := context.Background()
+
+	held, err := Acquire(ctx, db, parent.Child("reports").String(), WithHierarchy())
+	require.NoError(t, err)
+	waitErr := make(chan error, 1)
+	go func() {
+		_, err := Acquire(ctx, db, parent.Child("reports", "7").String(), WithHierarchy(), WithTimeout(2*time.Second))
+		waitErr <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	// the waiting descendant doesn't hold the shared ancestor while it waits
+	h, err := Acquire(ctx, db, parent.Child("billing").String(), WithHierarchy(), WithTimeout(500*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+	require.Error(t, <-waitErr)
+	require.NoError(t, held.Release())
+}
+
+func waitForFree(t *testing.T, db *sql.DB, lockName string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		owner, err := GetLockOwner(context.Background(), db, lockName)
+		return err == nil && owner == nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,68 @@
+// Package testdb connects tests to the MySQL server from docker-compose.yml, or to the one at MYSQL_ADDR when it
+// is set.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	addr      string
+	setupOnce sync.Once
+)
+
+// Addr returns the address of the test MySQL server.
+func Addr(t *testing.T) string {
+	t.Helper()
+	setupOnce.Do(func() {
+		addr = os.Getenv("MYSQL_ADDR")
+		if addr != "" {
+			return
+		}
+		_, file, _, _ := runtime.Caller(0)
+		cmd := exec.Command("docker-compose", "port", "mysql", "3306")
+		cmd.Dir = filepath.Join(filepath.Dir(file), "..", "..")
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		addr = strings.TrimSpace(string(out))
+		require.NoError(t, mysql.SetLogger(log.New(ioutil.Discard, "", 0)))
+	})
+	return addr
+}
+
+// DB returns a *sql.DB for the test MySQL server that is closed when the test ends. It waits up to a minute for the
+// server to accept connections.
+func DB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("mysql", fmt.Sprintf("root:@tcp(%s)/", Addr(t)))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	for ctx.Err() == nil {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NoError(t, err, "timed out waiting for connection")
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+	return db
+}
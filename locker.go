@@ -0,0 +1,234 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Locker gets locks from a db using a shared configuration, so callers don't need to repeat options everywhere
+// they take a lock.
+type Locker struct {
+	db        *sql.DB
+	defaults  []LockOption
+	namespace string
+	less      func(a, b string) bool
+	slots     chan struct{}
+	heldMux   sync.Mutex
+	held      map[*Handle]struct{}
+	// budget and budgetWarn are set by WithPoolBudget. overBudget is guarded by heldMux.
+	budget     float64
+	budgetWarn func(warning PoolWarning)
+	overBudget bool
+	// statsMux guards stats, which holds the counters for Stats by namespaced lock name
+	statsMux sync.Mutex
+	stats    map[string]*lockCounters
+	// profiles are set by WithProfiles
+	profiles map[string]LockProfile
+	// ownsDB is set when the Locker opened db itself
+	ownsDB bool
+}
+
+// LockerOption is an optional value for NewLocker
+type LockerOption func(*Locker)
+
+// WithDefaults sets options used for every lock from the Locker. Options passed when getting a lock are applied
+// after the defaults, so they take precedence.
+func WithDefaults(options ...LockOption) LockerOption {
+	return func(l *Locker) {
+		l.defaults = append(l.defaults, options...)
+	}
+}
+
+// WithNamespace prefixes the names of locks from the Locker with namespace and a colon, so different applications
+// sharing a server can use the same lock names.
+func WithNamespace(namespace string) LockerOption {
+	return func(l *Locker) {
+		l.namespace = namespace
+	}
+}
+
+// NewLocker returns a Locker that gets locks from db.
+func NewLocker(db *sql.DB, options ...LockerOption) *Locker {
+	l := &Locker{
+		db: db,
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l
+}
+
+// ErrMaxLocks is returned when a Locker with WithMaxLocks already holds as many locks as it is allowed.
+var ErrMaxLocks = errors.New("could not obtain lock: too many locks held")
+
+// WithMaxLocks limits the number of locks the Locker holds at once, which bounds how many database connections it
+// uses. When the limit is reached, getting another lock waits for one to be released if the lock would wait, as it
+// does with "WithTimeout" or a ctx deadline, or fails with ErrMaxLocks otherwise. n of zero or less means no limit.
+func WithMaxLocks(n int) LockerOption {
+	return func(l *Locker) {
+		l.slots = nil
+		if n > 0 {
+			l.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// Lock is like the package-level Lock using the Locker's db and options.
+func (l *Locker) Lock(ctx context.Context, lockName string, options ...LockOption) (<-chan error, error) {
+	h, err := l.Acquire(ctx, lockName, options...)
+	if err != nil {
+		return nil, err
+	}
+	return handleErrs(h), nil
+}
+
+// Acquire is like the package-level Acquire using the Locker's db and options.
+func (l *Locker) Acquire(ctx context.Context, lockName string, options ...LockOption) (*Handle, error) {
+	return l.acquire(ctx, l.name(lockName), l.options(options))
+}
+
+// acquire gets the lock named lockName, which is already namespaced, with options that already include the Locker's.
+func (l *Locker) acquire(ctx context.Context, lockName string, options []LockOption) (*Handle, error) {
+	err := l.checkOrder(ctx, lockName)
+	if err != nil {
+		return nil, err
+	}
+	return l.withSlot(ctx, options, func() (*Handle, error) {
+		return Acquire(ctx, l.db, lockName, options...)
+	})
+}
+
+// LockAny is like the package-level LockAny using the Locker's db and options.
+func (l *Locker) LockAny(ctx context.Context, names []string, options ...LockOption) (*Handle, error) {
+	namespaced := make([]string, len(names))
+	for i, name := range names {
+		namespaced[i] = l.name(name)
+	}
+	options = l.options(options)
+	return l.withSlot(ctx, options, func() (*Handle, error) {
+		return LockAny(ctx, l.db, namespaced, options...)
+	})
+}
+
+// withSlot reserves one of the Locker's WithMaxLocks slots for the lock returned by acquire and frees it when the
+// lock is released. The lock is tracked for HeldLocks until it is released.
+func (l *Locker) withSlot(ctx context.Context, options []LockOption, acquire func() (*Handle, error)) (*Handle, error) {
+	if l.slots == nil {
+		h, err := acquire()
+		if err != nil {
+			return nil, err
+		}
+		l.track(h)
+		return h, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		opts := newLockOpts(options)
+		if !opts.waits(ctx) {
+			return nil, ErrMaxLocks
+		}
+		var timeout <-chan time.Time
+		if opts.timeout > 0 {
+			timer := time.NewTimer(opts.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case l.slots <- struct{}{}:
+		case <-timeout:
+			return nil, ErrMaxLocks
+		case <-ctx.Done():
+			return nil, fmt.Errorf("could not obtain lock: %w", ctx.Err())
+		}
+	}
+	h, err := acquire()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	go func() {
+		<-h.Done()
+		<-l.slots
+	}()
+	l.track(h)
+	return h, nil
+}
+
+// track adds h to the Locker's held locks until it is released.
+func (l *Locker) track(h *Handle) {
+	l.heldMux.Lock()
+	if l.held == nil {
+		l.held = map[*Handle]struct{}{}
+	}
+	l.held[h] = struct{}{}
+	warning, warn := l.checkBudget()
+	l.heldMux.Unlock()
+	if warn {
+		l.budgetWarn(warning)
+	}
+	go func() {
+		<-h.Done()
+		l.heldMux.Lock()
+		delete(l.held, h)
+		l.checkBudget()
+		l.heldMux.Unlock()
+	}()
+}
+
+// HeldLocks returns information about every lock from the Locker that hasn't been released, sorted by name.
+func (l *Locker) HeldLocks() []LockInfo {
+	l.heldMux.Lock()
+	infos := make([]LockInfo, 0, len(l.held))
+	for h := range l.held {
+		infos = append(infos, h.Info())
+	}
+	l.heldMux.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Epoch < infos[j].Epoch
+	})
+	return infos
+}
+
+// PoolStats returns statistics for the Locker's database connections.
+func (l *Locker) PoolStats() sql.DBStats {
+	return l.db.Stats()
+}
+
+// Close closes the Locker's connection pool when it was opened by NewLockerConnector, which releases any locks
+// still held. It does nothing for Lockers created with NewLocker.
+func (l *Locker) Close() error {
+	if !l.ownsDB {
+		return nil
+	}
+	return l.db.Close()
+}
+
+// name returns lockName in the Locker's namespace.
+func (l *Locker) name(lockName string) string {
+	return namespaced(l.namespace, lockName)
+}
+
+// namespaced returns lockName prefixed with namespace and a colon, or lockName when namespace is empty.
+func namespaced(namespace, lockName string) string {
+	if namespace == "" {
+		return lockName
+	}
+	return namespace + ":" + lockName
+}
+
+// options returns the Locker's defaults followed by options and an option counting the lock for Stats.
+func (l *Locker) options(options []LockOption) []LockOption {
+	options = append(l.defaults[:len(l.defaults):len(l.defaults)], options...)
+	return append(options, func(o *lockOpts) {
+		o.counters = l.counters
+	})
+}
@@ -0,0 +1,198 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestLocker(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	locker := NewLocker(db,
+		WithNamespace("test"),
+		WithDefaults(WithPingInterval(10*time.Millisecond)),
+	)
+	h, err := locker.Acquire(ctx, lockName)
+	require.NoError(t, err)
+	require.Equal(t, "test:"+lockName, h.Name())
+	require.Equal(t, 10*time.Millisecond, h.opts.pingInterval)
+
+	_, err = locker.Lock(ctx, lockName)
+	require.Error(t, err)
+
+	// a different namespace doesn't conflict
+	errs, err := NewLocker(db, WithNamespace("other")).Lock(ctx, lockName)
+	require.NoError(t, err)
+
+	cancel()
+	<-h.Done()
+	require.NoError(t, h.Err())
+	require.NoError(t, <-errs)
+}
+
+func TestWithMaxLocks(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	locker := NewLocker(db, WithNamespace(t.Name()), WithMaxLocks(1))
+	holdCtx, holdCancel := context.WithCancel(ctx)
+	defer holdCancel()
+	h, err := locker.Acquire(holdCtx, "a")
+	require.NoError(t, err)
+	_, err = locker.Acquire(ctx, "b")
+	require.Equal(t, ErrMaxLocks, err)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		holdCancel()
+	}()
+	errs, err := locker.Lock(ctx, "b", WithTimeout(time.Second))
+	require.NoError(t, err)
+	<-h.Done()
+	cancel()
+	require.NoError(t, <-errs)
+
+	// a ctx deadline waits for a slot too
+	h, err = locker.Acquire(context.Background(), "c")
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = h.Release() //nolint:errcheck
+	}()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	h, err = locker.Acquire(waitCtx, "d")
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+
+	// zero means no limit
+	locker = NewLocker(db, WithNamespace(t.Name()), WithMaxLocks(0))
+	h, err = locker.Acquire(context.Background(), "e")
+	require.NoError(t, err)
+	h2, err := locker.Acquire(context.Background(), "f")
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+	require.NoError(t, h2.Release())
+}
+
+func TestLockerHeldLocks(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	locker := NewLocker(db,
+		WithNamespace(t.Name()),
+		WithDefaults(WithPingInterval(10*time.Millisecond), WithOwnerID("held-locks-test")),
+	)
+	require.Empty(t, locker.HeldLocks())
+	b, err := locker.Acquire(ctx, "b")
+	require.NoError(t, err)
+	a, err := locker.Acquire(ctx, "a")
+	require.NoError(t, err)
+
+	held := locker.HeldLocks()
+	require.Len(t, held, 2)
+	require.Equal(t, t.Name()+":a", held[0].Name)
+	require.Equal(t, t.Name()+":b", held[1].Name)
+	require.Equal(t, "held-locks-test", held[0].OwnerID)
+	require.Greater(t, held[0].Epoch, held[1].Epoch)
+	require.False(t, held[0].AcquiredAt.IsZero())
+	require.Eventually(t, func() bool {
+		return !a.Info().LastRenewal.IsZero()
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.Release())
+	require.Eventually(t, func() bool {
+		return len(locker.HeldLocks()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLockerStats(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	locker := NewLocker(db,
+		WithNamespace(t.Name()),
+		WithDefaults(WithPingInterval(10*time.Millisecond)),
+	)
+	require.Equal(t, LockStats{}, locker.Stats("a"))
+	h, err := locker.Acquire(ctx, "a")
+	require.NoError(t, err)
+	_, err = locker.Acquire(ctx, "a")
+	require.Error(t, err)
+	require.Eventually(t, func() bool {
+		return locker.Stats("a").Renewals > 0
+	}, time.Second, 10*time.Millisecond)
+
+	// losing the lock's session counts as a loss
+	require.NoError(t, h.Conn(func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, t.Name()+":a")
+		return err
+	}))
+	<-h.Done()
+	stats := locker.Stats("a")
+	require.Equal(t, int64(2), stats.Attempts)
+	require.Equal(t, int64(1), stats.Contended)
+	require.Equal(t, int64(1), stats.Losses)
+	require.Equal(t, LockStats{}, locker.Stats("b"))
+}
+
+func TestLockerStatsLimit(t *testing.T) {
+	locker := NewLocker(nil)
+	held := &Handle{lockName: "held"}
+	locker.held = map[*Handle]struct{}{held: {}}
+	locker.counters("held").attempt()
+	for i := 1; i < maxStatsNames; i++ {
+		locker.counters(fmt.Sprint(i)).attempt()
+	}
+	require.Len(t, locker.stats, maxStatsNames)
+
+	// going over the limit drops the counts for names that aren't held
+	locker.counters("new").attempt()
+	require.Len(t, locker.stats, 2)
+	require.Equal(t, int64(1), locker.Stats("held").Attempts)
+	require.Equal(t, int64(1), locker.Stats("new").Attempts)
+	require.Equal(t, LockStats{}, locker.Stats("1"))
+}
+
+func TestWithPoolBudget(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	db.SetMaxOpenConns(4)
+	ctx := context.Background()
+	var warnings []PoolWarning
+	locker := NewLocker(db, WithNamespace(t.Name()), WithPoolBudget(0.5, func(warning PoolWarning) {
+		warnings = append(warnings, warning)
+	}))
+	a, err := locker.Acquire(ctx, "a")
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	b, err := locker.Acquire(ctx, "b")
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	require.Equal(t, 2, warnings[0].HeldLocks)
+	require.Equal(t, 4, warnings[0].MaxOpenConns)
+	c, err := locker.Acquire(ctx, "c")
+	require.NoError(t, err)
+	require.Len(t, warnings, 1, "only warns when crossing the budget")
+	require.NoError(t, c.Release())
+	require.NoError(t, b.Release())
+	require.Eventually(t, func() bool {
+		return len(locker.HeldLocks()) == 1
+	}, time.Second, 10*time.Millisecond)
+	b, err = locker.Acquire(ctx, "b")
+	require.NoError(t, err)
+	require.Len(t, warnings, 2)
+	require.NoError(t, a.Release())
+	require.NoError(t, b.Release())
+}
@@ -0,0 +1,238 @@
+// Package lockertest is a conformance suite for lock backends. It checks that a backend keeps the contract of
+// mysqllocker.Handle: mutual exclusion, renewal, loss detection, release and timeouts. Authors of backends for other
+// databases, or of wrappers around mysqllocker, can run it from their own tests to verify they behave the same way.
+package lockertest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// Lock is a held lock. *mysqllocker.Handle is a Lock.
+type Lock interface {
+	// Done returns a channel that is closed when the lock is released or lost.
+	Done() <-chan struct{}
+	// Err returns the error that ended the lock after Done is closed. It is nil when the lock was released without
+	// an error and not nil when the lock was lost.
+	Err() error
+	// Release releases the lock and returns Err. It is safe to call more than once.
+	Release() error
+}
+
+// Backend is a lock implementation under test.
+type Backend interface {
+	// Acquire gets the lock named name and holds it until ctx is canceled or the lock is released. When another
+	// session holds the lock, it waits up to timeout for it and then returns an error. A zero timeout doesn't wait.
+	Acquire(ctx context.Context, name string, timeout time.Duration) (Lock, error)
+	// Break makes the holder of name lose the lock without releasing it, such as by killing its session.
+	Break(ctx context.Context, name string) error
+}
+
+// LossTimeout is how long RunConformance waits for a broken lock to be reported lost and for other events that
+// depend on the backend noticing something. Backends should check their locks more often than this.
+var LossTimeout = 10 * time.Second
+
+// RunConformance runs the conformance suite as subtests of t. newBackend is called for each subtest.
+func RunConformance(t *testing.T, newBackend func(t *testing.T) Backend) {
+	t.Run("MutualExclusion", func(t *testing.T) {
+		testMutualExclusion(t, newBackend(t))
+	})
+	t.Run("Renewal", func(t *testing.T) {
+		testRenewal(t, newBackend(t))
+	})
+	t.Run("LossDetection", func(t *testing.T) {
+		testLossDetection(t, newBackend(t))
+	})
+	t.Run("Release", func(t *testing.T) {
+		testRelease(t, newBackend(t))
+	})
+	t.Run("ContextCancel", func(t *testing.T) {
+		testContextCancel(t, newBackend(t))
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		testTimeout(t, newBackend(t))
+	})
+}
+
+// lockName returns a name no other test uses.
+func lockName() string {
+	return fmt.Sprintf("lockertest/%d", rand.Int63())
+}
+
+func mustAcquire(ctx context.Context, t *testing.T, b Backend, name string, timeout time.Duration) Lock {
+	t.Helper()
+	l, err := b.Acquire(ctx, name, timeout)
+	if err != nil {
+		t.Fatalf("could not acquire %q: %v", name, err)
+	}
+	t.Cleanup(func() {
+		_ = l.Release() //nolint:errcheck
+	})
+	return l
+}
+
+func requireHeld(t *testing.T, b Backend, name string) {
+	t.Helper()
+	l, err := b.Acquire(context.Background(), name, 0)
+	if err == nil {
+		_ = l.Release() //nolint:errcheck
+		t.Fatalf("acquired %q while it was held", name)
+	}
+}
+
+func requireDone(t *testing.T, l Lock) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(LossTimeout):
+		t.Fatalf("lock wasn't done after %v", LossTimeout)
+	}
+}
+
+func requireNotDone(t *testing.T, l Lock) {
+	t.Helper()
+	select {
+	case <-l.Done():
+		t.Fatalf("lock ended unexpectedly: %v", l.Err())
+	default:
+	}
+}
+
+func testMutualExclusion(t *testing.T, b Backend) {
+	ctx := context.Background()
+	name := lockName()
+	l := mustAcquire(ctx, t, b, name, 0)
+	requireHeld(t, b, name)
+	requireNotDone(t, l)
+	// a different name isn't excluded
+	mustAcquire(ctx, t, b, lockName(), 0)
+	if err := l.Release(); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	mustAcquire(ctx, t, b, name, 0)
+}
+
+func testRenewal(t *testing.T, b Backend) {
+	ctx := context.Background()
+	name := lockName()
+	l := mustAcquire(ctx, t, b, name, 0)
+	time.Sleep(LossTimeout / 5)
+	requireNotDone(t, l)
+	requireHeld(t, b, name)
+	if err := l.Release(); err != nil {
+		t.Fatalf("release after holding failed: %v", err)
+	}
+}
+
+func testLossDetection(t *testing.T, b Backend) {
+	ctx := context.Background()
+	name := lockName()
+	l := mustAcquire(ctx, t, b, name, 0)
+	if err := b.Break(ctx, name); err != nil {
+		t.Fatalf("could not break %q: %v", name, err)
+	}
+	requireDone(t, l)
+	if l.Err() == nil {
+		t.Fatal("lost lock ended without an error")
+	}
+	if err := l.Release(); err != l.Err() {
+		t.Fatalf("Release returned %v instead of Err's %v", err, l.Err())
+	}
+	mustAcquire(ctx, t, b, name, LossTimeout)
+}
+
+func testRelease(t *testing.T, b Backend) {
+	ctx := context.Background()
+	name := lockName()
+	l := mustAcquire(ctx, t, b, name, 0)
+	if err := l.Release(); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	select {
+	case <-l.Done():
+	default:
+		t.Fatal("Done wasn't closed when Release returned")
+	}
+	if err := l.Err(); err != nil {
+		t.Fatalf("released lock has error %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatalf("second release failed: %v", err)
+	}
+	mustAcquire(ctx, t, b, name, 0)
+}
+
+func testContextCancel(t *testing.T, b Backend) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	name := lockName()
+	l := mustAcquire(ctx, t, b, name, 0)
+	cancel()
+	requireDone(t, l)
+	if err := l.Err(); err != nil {
+		t.Fatalf("lock released by ctx has error %v", err)
+	}
+	mustAcquire(context.Background(), t, b, name, 0)
+}
+
+func testTimeout(t *testing.T, b Backend) {
+	ctx := context.Background()
+	name := lockName()
+	l := mustAcquire(ctx, t, b, name, 0)
+
+	timeout := 2 * time.Second
+	start := time.Now()
+	_, err := b.Acquire(ctx, name, timeout)
+	if err == nil {
+		t.Fatalf("acquired %q while it was held", name)
+	}
+	if waited := time.Since(start); waited < timeout/2 {
+		t.Fatalf("gave up after %v instead of waiting about %v", waited, timeout)
+	}
+
+	go func() {
+		time.Sleep(timeout / 4)
+		_ = l.Release() //nolint:errcheck
+	}()
+	mustAcquire(ctx, t, b, name, timeout)
+}
+
+// MySQL returns a Backend for mysqllocker.Acquire with options. Break kills the lock's connection.
+func MySQL(db *sql.DB, options ...mysqllocker.LockOption) Backend {
+	return &mysqlBackend{
+		db:      db,
+		options: options,
+	}
+}
+
+type mysqlBackend struct {
+	db      *sql.DB
+	options []mysqllocker.LockOption
+}
+
+func (b *mysqlBackend) Acquire(ctx context.Context, name string, timeout time.Duration) (Lock, error) {
+	options := append(b.options[:len(b.options):len(b.options)], mysqllocker.WithTimeout(timeout))
+	if timeout <= 0 {
+		options = append(options, mysqllocker.WithNoWait())
+	}
+	return mysqllocker.Acquire(ctx, b.db, name, options...)
+}
+
+func (b *mysqlBackend) Break(ctx context.Context, name string) error {
+	var connectionID sql.NullInt64
+	err := b.db.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?)`, name).Scan(&connectionID)
+	if err != nil {
+		return err
+	}
+	if !connectionID.Valid {
+		return fmt.Errorf("lock %q isn't held", name)
+	}
+	_, err = b.db.ExecContext(ctx, `KILL ?`, connectionID.Int64)
+	return err
+}
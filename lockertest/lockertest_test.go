@@ -0,0 +1,16 @@
+package lockertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestMySQL(t *testing.T) {
+	db := testdb.DB(t)
+	RunConformance(t, func(t *testing.T) Backend {
+		return MySQL(db, mysqllocker.WithPingInterval(100*time.Millisecond))
+	})
+}
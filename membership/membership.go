@@ -0,0 +1,326 @@
+// Package membership is a cluster membership registry built on mysqllocker. Each process joins a group by holding a
+// lock for its member id and announcing itself in a lease row that it renews while it is a member. A member is live
+// exactly as long as its session holds the lock, so there are no lease TTLs to tune, and the row's renewal time shows
+// when the member was last heard from. One live member at a time is also elected leader, so processes can ask "who
+// is alive and who leads" in one place.
+//
+// Members hold the leader lock on the same session as their member lock, so the server must allow a session more
+// than one named lock, which MySQL does from 5.7.
+package membership
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// ErrAlreadyJoined is returned by Join when a live member already has the id.
+var ErrAlreadyJoined = errors.New("member id is already in use")
+
+const (
+	defaultCampaignInterval = time.Second
+	defaultLeaseInterval    = 10 * time.Second
+)
+
+// Registry is the membership of a group, stored in a table. The table must already exist, such as from
+// EnsureSchema, with at least these columns:
+//
+//	CREATE TABLE membership (
+//	  group_name VARCHAR(64) NOT NULL,
+//	  member_id VARCHAR(255) NOT NULL,
+//	  lock_name VARCHAR(64) NOT NULL,
+//	  connection_id BIGINT UNSIGNED NOT NULL,
+//	  joined_at DATETIME(6) NOT NULL,
+//	  renewed_at DATETIME(6) NOT NULL,
+//	  PRIMARY KEY (group_name, member_id)
+//	)
+//
+// Rows of members that have left stay in the table until the id joins again, but they aren't listed.
+type Registry struct {
+	db               *sql.DB
+	table            string
+	group            string
+	campaignInterval time.Duration
+	leaseInterval    time.Duration
+	lockOptions      []mysqllocker.LockOption
+}
+
+// Option is an optional value for New
+type Option func(*Registry)
+
+// WithCampaignInterval sets how often members that aren't the leader try to become it. Default is one second.
+func WithCampaignInterval(interval time.Duration) Option {
+	return func(r *Registry) {
+		r.campaignInterval = interval
+	}
+}
+
+// WithLeaseInterval sets how often members renew their lease rows. Default is ten seconds. Liveness comes from the
+// member locks, so this only controls how current MemberInfo.RenewedAt is.
+func WithLeaseInterval(interval time.Duration) Option {
+	return func(r *Registry) {
+		r.leaseInterval = interval
+	}
+}
+
+// WithLockOptions sets options for the member locks, such as mysqllocker.WithPingInterval to control how quickly a
+// lost member notices.
+func WithLockOptions(options ...mysqllocker.LockOption) Option {
+	return func(r *Registry) {
+		r.lockOptions = append(r.lockOptions, options...)
+	}
+}
+
+// New returns a Registry for group stored in table. table is used in queries as-is, so it may be qualified with a
+// database name.
+func New(db *sql.DB, table, group string, options ...Option) *Registry {
+	r := &Registry{
+		db:               db,
+		table:            table,
+		group:            group,
+		campaignInterval: defaultCampaignInterval,
+		leaseInterval:    defaultLeaseInterval,
+	}
+	for _, o := range options {
+		o(r)
+	}
+	return r
+}
+
+// MemberLockName returns the name of the lock held by the member with id.
+func (r *Registry) MemberLockName(id string) string {
+	return mysqllocker.Name("membership", r.group, "member", id).String()
+}
+
+// LeaderLockName returns the name of the lock held by the group's leader.
+func (r *Registry) LeaderLockName() string {
+	return mysqllocker.Name("membership", r.group, "leader").String()
+}
+
+// Join adds this process to the group as id and keeps it a member until ctx is canceled, Member.Leave is called or
+// its lock is lost. It returns ErrAlreadyJoined when a live member already has id, and a *mysqllocker.UnsupportedError
+// when the server allows only one named lock per session. The new member renews its lease row and campaigns to be
+// leader in the background.
+func (r *Registry) Join(ctx context.Context, id string) (*Member, error) {
+	lockName := r.MemberLockName(id)
+	// the leader lock is taken on the member's session, so releasing the member must release it too
+	options := append(r.lockOptions[:len(r.lockOptions):len(r.lockOptions)],
+		mysqllocker.WithOwnerID(id), mysqllocker.WithReleaseAll(), mysqllocker.WithNoWait())
+	h, err := mysqllocker.Acquire(ctx, r.db, lockName, options...)
+	if err != nil {
+		owner, ownerErr := mysqllocker.GetLockOwner(ctx, r.db, lockName)
+		if ownerErr == nil && owner != nil {
+			return nil, fmt.Errorf("%s: %w", id, ErrAlreadyJoined)
+		}
+		return nil, err
+	}
+	m := &Member{
+		id:     id,
+		r:      r,
+		handle: h,
+	}
+	err = h.Conn(func(conn *sql.Conn) error {
+		err := r.checkMultipleLocks(ctx, conn, id)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO %s (group_name, member_id, lock_name, connection_id, joined_at, renewed_at)
+VALUES (?, ?, ?, CONNECTION_ID(), NOW(6), NOW(6))
+ON DUPLICATE KEY UPDATE lock_name = VALUES(lock_name), connection_id = VALUES(connection_id),
+  joined_at = VALUES(joined_at), renewed_at = VALUES(renewed_at)`, r.table), r.group, id, lockName)
+		return err
+	})
+	if err != nil {
+		_ = h.Release() //nolint:errcheck
+		return nil, err
+	}
+	go m.run()
+	return m, nil
+}
+
+// checkMultipleLocks returns an *mysqllocker.UnsupportedError when conn's session loses the member lock for id by
+// taking another named lock, as it does on servers before 5.7.
+func (r *Registry) checkMultipleLocks(ctx context.Context, conn *sql.Conn, id string) error {
+	probe := mysqllocker.Name("membership", r.group, "probe", id).String()
+	var got sql.NullBool
+	err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, probe).Scan(&got)
+	if err != nil {
+		return err
+	}
+	var held bool
+	err = conn.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?) <=> CONNECTION_ID()`, r.MemberLockName(id)).Scan(&held)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, probe)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return &mysqllocker.UnsupportedError{
+			Feature: "membership",
+			Err:     errors.New("the server allows only one named lock per session"),
+		}
+	}
+	return nil
+}
+
+// MemberInfo describes a live member of a group.
+type MemberInfo struct {
+	ID       string
+	JoinedAt time.Time
+	// RenewedAt is when the member last renewed its lease row.
+	RenewedAt time.Time
+	// Leader is whether the member is the group's leader.
+	Leader bool
+}
+
+// Members returns the group's live members sorted by id.
+func (r *Registry) Members(ctx context.Context) ([]MemberInfo, error) {
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT member_id, FLOOR(UNIX_TIMESTAMP(joined_at) * 1000000), FLOOR(UNIX_TIMESTAMP(renewed_at) * 1000000),
+  connection_id <=> IS_USED_LOCK(?) FROM %s
+WHERE group_name = ? AND connection_id = IS_USED_LOCK(lock_name)
+ORDER BY member_id`, r.table), r.LeaderLockName(), r.group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+	var members []MemberInfo
+	for rows.Next() {
+		var member MemberInfo
+		var joinedAt, renewedAt int64
+		err = rows.Scan(&member.ID, &joinedAt, &renewedAt, &member.Leader)
+		if err != nil {
+			return nil, err
+		}
+		member.JoinedAt = time.UnixMicro(joinedAt)
+		member.RenewedAt = time.UnixMicro(renewedAt)
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// Leader returns the id of the group's leader, or "" when there is no leader at the moment, such as just after the
+// leader left.
+func (r *Registry) Leader(ctx context.Context) (string, error) {
+	var id string
+	err := r.db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT member_id FROM %s
+WHERE group_name = ? AND connection_id = IS_USED_LOCK(lock_name) AND connection_id = IS_USED_LOCK(?)`, r.table),
+		r.group, r.LeaderLockName()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// SchemaSQL returns the CREATE TABLE statement for the registry's table with tableOptions, such as
+// "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", after it. It is for teams that manage DDL through their own migrations
+// instead of EnsureSchema.
+func (r *Registry) SchemaSQL(tableOptions string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  group_name VARCHAR(64) NOT NULL,
+  member_id VARCHAR(255) NOT NULL,
+  lock_name VARCHAR(64) NOT NULL,
+  connection_id BIGINT UNSIGNED NOT NULL,
+  joined_at DATETIME(6) NOT NULL,
+  renewed_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (group_name, member_id)
+) %s`, r.table, tableOptions)
+}
+
+// EnsureSchema creates the registry's table with the statement from SchemaSQL and mysqllocker.DefaultTableOptions
+// if it doesn't exist.
+func (r *Registry) EnsureSchema(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, r.SchemaSQL(mysqllocker.DefaultTableOptions))
+	return err
+}
+
+// Member is this process's membership in a group.
+type Member struct {
+	id     string
+	r      *Registry
+	handle *mysqllocker.Handle
+	leader int32
+}
+
+// ID returns the member's id.
+func (m *Member) ID() string {
+	return m.id
+}
+
+// IsLeader returns whether the member is the group's leader. Leadership lasts until the membership ends.
+func (m *Member) IsLeader() bool {
+	select {
+	case <-m.handle.Done():
+		return false
+	default:
+		return atomic.LoadInt32(&m.leader) == 1
+	}
+}
+
+// Done returns a channel that is closed when the membership ends.
+func (m *Member) Done() <-chan struct{} {
+	return m.handle.Done()
+}
+
+// Err returns the error that ended the membership, like mysqllocker.Handle.Err.
+func (m *Member) Err() error {
+	return m.handle.Err()
+}
+
+// Leave ends the membership, giving up leadership if the member has it, and returns the error that ended it, like
+// Err.
+func (m *Member) Leave() error {
+	return m.handle.Release()
+}
+
+// run renews the member's lease row and campaigns to be leader until the membership ends.
+func (m *Member) run() {
+	campaignTicker := time.NewTicker(m.r.campaignInterval)
+	defer campaignTicker.Stop()
+	leaseTicker := time.NewTicker(m.r.leaseInterval)
+	defer leaseTicker.Stop()
+	m.campaign()
+	for {
+		select {
+		case <-m.handle.Done():
+			return
+		case <-campaignTicker.C:
+			if atomic.LoadInt32(&m.leader) == 0 {
+				m.campaign()
+			}
+		case <-leaseTicker.C:
+			m.renewLease()
+		}
+	}
+}
+
+// campaign tries once to take the leader lock on the member's session.
+func (m *Member) campaign() {
+	var got sql.NullBool
+	err := m.handle.Conn(func(conn *sql.Conn) error {
+		return conn.QueryRowContext(context.Background(), `SELECT GET_LOCK(?, 0)`, m.r.LeaderLockName()).Scan(&got)
+	})
+	if err == nil && got.Valid && got.Bool {
+		atomic.StoreInt32(&m.leader, 1)
+	}
+}
+
+// renewLease updates the member's lease row with the time. A failed renewal is left for the next one. The member lock
+// decides liveness.
+func (m *Member) renewLease() {
+	_ = m.handle.Conn(func(conn *sql.Conn) error { //nolint:errcheck
+		_, err := conn.ExecContext(context.Background(), fmt.Sprintf(`
+UPDATE %s SET renewed_at = NOW(6) WHERE group_name = ? AND member_id = ? AND connection_id = CONNECTION_ID()`,
+			m.r.table), m.r.group, m.id)
+		return err
+	})
+}
@@ -0,0 +1,91 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.membership_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	r := New(db, table, t.Name(), WithCampaignInterval(10*time.Millisecond), WithLeaseInterval(10*time.Millisecond))
+	require.NoError(t, r.EnsureSchema(ctx))
+
+	members, err := r.Members(ctx)
+	require.NoError(t, err)
+	require.Empty(t, members)
+	leader, err := r.Leader(ctx)
+	require.NoError(t, err)
+	require.Empty(t, leader)
+
+	a, err := r.Join(ctx, "a")
+	require.NoError(t, err)
+	require.Eventually(t, a.IsLeader, time.Second, 10*time.Millisecond)
+	b, err := r.Join(ctx, "b")
+	require.NoError(t, err)
+	_, err = r.Join(ctx, "a")
+	require.True(t, errors.Is(err, ErrAlreadyJoined))
+
+	members, err = r.Members(ctx)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	require.Equal(t, "a", members[0].ID)
+	require.True(t, members[0].Leader)
+	require.Equal(t, "b", members[1].ID)
+	require.False(t, members[1].Leader)
+	require.WithinDuration(t, time.Now(), members[1].JoinedAt, time.Minute)
+
+	// members renew their lease rows while they are live
+	require.Eventually(t, func() bool {
+		members, err = r.Members(ctx)
+		require.NoError(t, err)
+		return members[1].RenewedAt.After(members[1].JoinedAt)
+	}, time.Second, 10*time.Millisecond)
+	leader, err = r.Leader(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "a", leader)
+
+	// the leader leaving hands leadership to another member
+	require.NoError(t, a.Leave())
+	require.False(t, a.IsLeader())
+	require.Eventually(t, b.IsLeader, time.Second, 10*time.Millisecond)
+	members, err = r.Members(ctx)
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	leader, err = r.Leader(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "b", leader)
+	require.NoError(t, b.Leave())
+}
+
+func TestJoinDeadline(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	table := "mysqllocker_test.membership_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(context.Background(), `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	r := New(db, table, t.Name())
+	require.NoError(t, r.EnsureSchema(ctx))
+	a, err := r.Join(ctx, "a")
+	require.NoError(t, err)
+
+	// a deadline doesn't make Join wait for the id's member to leave
+	start := time.Now()
+	_, err = r.Join(ctx, "a")
+	require.True(t, errors.Is(err, ErrAlreadyJoined))
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.NoError(t, a.Leave())
+}
@@ -0,0 +1,56 @@
+package mysqllocker
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// metrics are process-wide lock counts. They are always collected and can be published with PublishExpvar.
+var metrics struct {
+	held            int64
+	acquired        int64
+	renewalFailures int64
+	holdNanos       int64
+}
+
+// recordAcquired records an acquisition and returns how many locks have been acquired, including this one.
+func recordAcquired() int64 {
+	atomic.AddInt64(&metrics.held, 1)
+	return atomic.AddInt64(&metrics.acquired, 1)
+}
+
+func recordReleased(held time.Duration) {
+	atomic.AddInt64(&metrics.held, -1)
+	atomic.AddInt64(&metrics.holdNanos, int64(held))
+}
+
+func recordRenewalFailure() {
+	atomic.AddInt64(&metrics.renewalFailures, 1)
+}
+
+// PublishExpvar publishes lock metrics with expvar as a map named prefix, so they show up on the /debug/vars
+// endpoint. The map has these keys:
+//
+//	held              locks currently held
+//	acquired          locks acquired since the process started
+//	renewal_failures  regular checks that failed with an error
+//	hold_seconds      total time locks were held, counting only released locks
+//
+// Like expvar.Publish, it panics if prefix is already published.
+func PublishExpvar(prefix string) {
+	m := new(expvar.Map)
+	m.Set("held", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&metrics.held)
+	}))
+	m.Set("acquired", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&metrics.acquired)
+	}))
+	m.Set("renewal_failures", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&metrics.renewalFailures)
+	}))
+	m.Set("hold_seconds", expvar.Func(func() interface{} {
+		return time.Duration(atomic.LoadInt64(&metrics.holdNanos)).Seconds()
+	}))
+	expvar.Publish(prefix, m)
+}
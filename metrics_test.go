@@ -0,0 +1,27 @@
+package mysqllocker
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	PublishExpvar(t.Name())
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs, err := Lock(ctx, db, lockName)
+	require.NoError(t, err)
+	var vars map[string]float64
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get(t.Name()).String()), &vars))
+	require.GreaterOrEqual(t, vars["held"], float64(1))
+	require.GreaterOrEqual(t, vars["acquired"], float64(1))
+	cancel()
+	require.NoError(t, <-errs)
+}
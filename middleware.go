@@ -0,0 +1,44 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RequireLock returns middleware that only serves requests while this process holds lockName and responds with
+// 503 Service Unavailable otherwise. It is meant for simple active/passive services.
+//
+// It starts trying to get the lock immediately and keeps trying until ctx is done, retrying at the ping interval
+// whenever the lock is unavailable or lost. The lock is released when ctx is done, after which every request gets a
+// 503.
+func RequireLock(ctx context.Context, db *sql.DB, lockName string, options ...LockOption) func(http.Handler) http.Handler {
+	retryInterval := newLockOpts(options).pingInterval
+	var held int32
+	go func() {
+		for {
+			h, err := Acquire(ctx, db, lockName, options...)
+			if err == nil {
+				atomic.StoreInt32(&held, 1)
+				<-h.Done()
+				atomic.StoreInt32(&held, 0)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+		}
+	}()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.LoadInt32(&held) == 0 {
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package mysqllocker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestRequireLock(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs, err := Lock(ctx, db, lockName)
+	require.NoError(t, err)
+
+	serveCtx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	handler := RequireLock(serveCtx, db, lockName, WithPingInterval(10*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	status := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusServiceUnavailable, status())
+
+	cancel()
+	require.NoError(t, <-errs)
+	require.Eventually(t, func() bool {
+		return status() == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	// the lock is released when ctx is done
+	stop()
+	require.Eventually(t, func() bool {
+		return status() == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	h, err := Acquire(context.Background(), db, lockName, WithTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+}
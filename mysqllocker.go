@@ -2,82 +2,313 @@ package mysqllocker
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"database/sql/driver"
-	"fmt"
+	"encoding/hex"
+	"errors"
+	"sync"
 	"time"
 )
 
 const defaultPingInterval = 10 * time.Second
 
 type lockOpts struct {
-	timeout      time.Duration
-	pingInterval time.Duration
+	timeout          time.Duration
+	noWait           bool
+	pingInterval     time.Duration
+	pingIntervalSet  bool
+	retries          int
+	retryBackoff     time.Duration
+	progressInterval time.Duration
+	progress         func(elapsed time.Duration)
+	sessionInit      []string
+	auditTable       string
+	failureThreshold int
+	gracePeriod      time.Duration
+	reentrant        bool
+	faults           func(point FaultPoint) error
+	checkEvery       int
+	errorHandler     func(err error)
+	hierarchical     bool
+	renewTimeout     time.Duration
+	releaseTimeout   time.Duration
+	ownerID          string
+	dataTable        string
+	checkProcedure   string
+	renewalCheck     func(ctx context.Context, conn *sql.Conn) error
+	eventSinks       []EventSink
+	holdAlarm        time.Duration
+	holdAlarmFunc    func(info LockInfo)
+	contestedWindow  time.Duration
+	diagnoseBlocker  bool
+	counters         func(lockName string) *lockCounters
+	waitSlice        time.Duration
+	releaseAll       bool
+	priority         int
+	preempt          func(req PreemptRequest)
+	preemptTable     string
+	maxHold          time.Duration
+	// slowRenewal and uncertainRenewal are set by WithRenewalSLO
+	slowRenewal      time.Duration
+	uncertainRenewal time.Duration
+	// minPingInterval and maxPingInterval are set by WithAdaptivePingInterval
+	minPingInterval time.Duration
+	maxPingInterval time.Duration
+	// sessionWaitTimeout and sessionNetReadTimeout are set by WithSessionTimeouts
+	sessionWaitTimeout    time.Duration
+	sessionNetReadTimeout time.Duration
+	// queryComments, commentApplication and commentTags are set by WithQueryComments
+	queryComments      bool
+	commentApplication string
+	commentTags        func(ctx context.Context) map[string]string
 }
 
-// LockOption is an optional value for Lock
+// LockOption is an optional value for Lock and Acquire
 type LockOption func(*lockOpts)
 
+var (
+	defaultOptionsMux sync.RWMutex
+	defaultOptions    []LockOption
+)
+
+// SetDefaultOptions sets options used for every lock in the process, so policies like ping intervals, timeouts and
+// error handlers can be changed in one place. They are applied before a lock's own options and before a Locker's
+// WithDefaults, so both take precedence. Each call replaces the previous defaults. Set them at startup, before
+// getting any locks.
+func SetDefaultOptions(options ...LockOption) {
+	defaultOptionsMux.Lock()
+	defaultOptions = append([]LockOption(nil), options...)
+	defaultOptionsMux.Unlock()
+}
+
+func newLockOpts(options []LockOption) *lockOpts {
+	opts := &lockOpts{
+		pingInterval: defaultPingInterval,
+	}
+	defaultOptionsMux.RLock()
+	for _, o := range defaultOptions {
+		o(opts)
+	}
+	defaultOptionsMux.RUnlock()
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
+
 // WithTimeout sets a timeout for Lock to wait before giving up on getting a lock.
-// When unset, Lock will error out immediately if the lock is unavailable.
+// When unset, Lock waits until ctx's deadline, or errors out immediately if the lock is unavailable and ctx has no
+// deadline. A negative timeout waits until ctx is done, however long that is.
 func WithTimeout(timeout time.Duration) LockOption {
 	return func(o *lockOpts) {
 		o.timeout = timeout
+		o.noWait = false
+	}
+}
+
+// WithNoWait makes Lock error out immediately if the lock is unavailable, even when ctx has a deadline. It replaces
+// WithTimeout.
+func WithNoWait() LockOption {
+	return func(o *lockOpts) {
+		o.timeout = 0
+		o.noWait = true
 	}
 }
 
-// WithPingInterval sets the interval for Lock to ping the connection. Default is 10 seconds.
+// WithPingInterval sets the interval for Lock to check that it still holds the lock. Default is 10 seconds, or a
+// third of the session's wait_timeout when that is shorter. Getting the lock fails when pingInterval isn't shorter
+// than wait_timeout.
 func WithPingInterval(pingInterval time.Duration) LockOption {
 	return func(o *lockOpts) {
 		o.pingInterval = pingInterval
+		o.pingIntervalSet = true
+	}
+}
+
+// WithAdaptivePingInterval adjusts the ping interval between min and max as the lock is held. The interval is halved
+// after a check that fails or takes more than a tenth of the interval, and grows by a quarter after a quick
+// successful check, so locks are checked often while the server is struggling and rarely while it is healthy.
+// Checking starts at the WithPingInterval value, limited to min and max.
+func WithAdaptivePingInterval(min, max time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.minPingInterval = min
+		o.maxPingInterval = max
+	}
+}
+
+// nextPingInterval returns the ping interval to use after a check that took rtt and failed when failed is true.
+// It returns interval unchanged unless WithAdaptivePingInterval is set.
+func (o *lockOpts) nextPingInterval(interval, rtt time.Duration, failed bool) time.Duration {
+	if o.minPingInterval <= 0 || o.maxPingInterval <= 0 {
+		return interval
+	}
+	if failed || rtt > interval/10 {
+		interval /= 2
+	} else {
+		interval += interval / 4
+	}
+	return o.clampPingInterval(interval)
+}
+
+// clampPingInterval limits interval to the WithAdaptivePingInterval bounds when they are set.
+func (o *lockOpts) clampPingInterval(interval time.Duration) time.Duration {
+	if o.minPingInterval <= 0 || o.maxPingInterval <= 0 {
+		return interval
+	}
+	if interval < o.minPingInterval {
+		return o.minPingInterval
+	}
+	if interval > o.maxPingInterval {
+		return o.maxPingInterval
+	}
+	return interval
+}
+
+// WithWaitProgress calls progress every interval while Lock is waiting for a lock with how long it has been waiting.
+// It is only useful along with WithTimeout or a ctx deadline.
+func WithWaitProgress(interval time.Duration, progress func(elapsed time.Duration)) LockOption {
+	return func(o *lockOpts) {
+		o.progressInterval = interval
+		o.progress = progress
+	}
+}
+
+// WithWaitSlice makes Lock wait for the lock with a series of GET_LOCK() calls of at most slice each, rounded down to
+// whole seconds, instead of one call for the whole wait. Each call is left to finish rather than canceled with ctx,
+// so canceling ctx takes effect within one slice and never has to break the connection to stop a waiting query.
+// It only applies when waiting, with WithTimeout or a ctx deadline.
+func WithWaitSlice(slice time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.waitSlice = slice
+	}
+}
+
+// WithRenewTimeout sets a deadline for each regular check. Without it, a check against a hung server can block
+// until the connection's own timeouts fire. A check that times out counts as a failed check. The default is no
+// deadline.
+func WithRenewTimeout(timeout time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.renewTimeout = timeout
+	}
+}
+
+// WithReleaseTimeout sets a deadline for RELEASE_LOCK() when the lock is released. The connection is closed when the
+// deadline passes, which ends the session and releases the lock on the server. The default is no deadline.
+func WithReleaseTimeout(timeout time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.releaseTimeout = timeout
+	}
+}
+
+// WithRenewalCheck sets a function to run on the lock's connection after each check that verifies the lock, for
+// application invariants such as a feature flag or the server not being read-only. When check returns an error, the
+// lock is released right away, regardless of WithFailureThreshold and WithGracePeriod, with a *CheckError.
+// check must not close conn or release the lock.
+func WithRenewalCheck(check func(ctx context.Context, conn *sql.Conn) error) LockOption {
+	return func(o *lockOpts) {
+		o.renewalCheck = check
+	}
+}
+
+// WithHoldAlarm calls alarm with the lock's info once it has been held for d and again every d after that, to catch
+// jobs that hold a lock far longer than expected. alarm is called from the goroutine that checks the lock, so it
+// should return quickly.
+func WithHoldAlarm(d time.Duration, alarm func(info LockInfo)) LockOption {
+	return func(o *lockOpts) {
+		o.holdAlarm = d
+		o.holdAlarmFunc = alarm
+	}
+}
+
+// ErrMaxHold is the error for a lock released because it was held for longer than WithMaxHold allows.
+var ErrMaxHold = errors.New("lock was held for longer than its max hold")
+
+// WithMaxHold releases the lock once it has been held for d, as a ceiling for jobs that may hang. The Handle's Err is
+// ErrMaxHold then.
+func WithMaxHold(d time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.maxHold = d
+	}
+}
+
+// WithErrorHandler calls handler with the error when a lock is released because of an error, such as the lock being
+// lost. It is an alternative to watching the channel from Lock or Handle.Done. Reading the channel from Lock is
+// optional; it is buffered and won't leak a goroutine when it is never read.
+func WithErrorHandler(handler func(err error)) LockOption {
+	return func(o *lockOpts) {
+		o.errorHandler = handler
+	}
+}
+
+// WithCheckEvery makes only every nth regular check verify that the lock is still held. The checks in between only
+// ping the connection to keep it alive, which is cheaper when many locks are held. The default is 1, which verifies
+// the lock on every check.
+func WithCheckEvery(n int) LockOption {
+	return func(o *lockOpts) {
+		o.checkEvery = n
+	}
+}
+
+// WithFailureThreshold sets how many checks in a row have to fail with an error before the lock is considered lost.
+// By default, the first failed check ends the lock. Checks that succeed but find the lock held by another session
+// always end the lock.
+func WithFailureThreshold(n int) LockOption {
+	return func(o *lockOpts) {
+		o.failureThreshold = n
+	}
+}
+
+// WithGracePeriod sets how long checks have to keep failing with an error before the lock is considered lost.
+// When used with WithFailureThreshold, the lock is lost when either limit is reached.
+func WithGracePeriod(gracePeriod time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.gracePeriod = gracePeriod
+	}
+}
+
+// lostAfter returns whether the lock should be considered lost after failures consecutive failed checks over
+// the duration failing.
+func (o *lockOpts) lostAfter(failures int, failing time.Duration) bool {
+	if o.failureThreshold <= 0 && o.gracePeriod <= 0 {
+		return true
+	}
+	if o.failureThreshold > 0 && failures >= o.failureThreshold {
+		return true
+	}
+	return o.gracePeriod > 0 && failing >= o.gracePeriod
+}
+
+// WithSessionInit sets statements to run on the lock's connection before getting the lock. Use it to set session
+// variables such as wait_timeout on the long-lived lock session.
+func WithSessionInit(stmts ...string) LockOption {
+	return func(o *lockOpts) {
+		o.sessionInit = append(o.sessionInit, stmts...)
 	}
 }
 
 // Lock gets a named lock from mysql using GET_LOCK() and holds it until ctx is canceled.
-// It pings the db connection at a regular interval to keep it from timing out.
+// It checks that the lock is still held at a regular interval, which also keeps the connection from timing out.
 // If the lock is unavailable and "WithTimeout" is set, it will continue trying until it either times out or obtains a lock.
 // Returns an error channel that will receive an error when the lock is released.
+// Use Acquire to get a Handle with access to the lock's connection.
 func Lock(ctx context.Context, db *sql.DB, lockName string, options ...LockOption) (<-chan error, error) {
-	opts := &lockOpts{
-		pingInterval: defaultPingInterval,
-	}
-	for _, o := range options {
-		o(opts)
-	}
-	conn, err := db.Conn(ctx)
+	h, err := Acquire(ctx, db, lockName, options...)
 	if err != nil {
 		return nil, err
 	}
+	return handleErrs(h), nil
+}
 
-	ok, err := getLock(ctx, conn, lockName, opts.timeout)
-	if err != nil || !ok {
-		_ = conn.Close() //nolint:errcheck
-		err = fmt.Errorf("could not obtain lock: %v", err)
-		return nil, err
-	}
+// handleErrs returns a channel that receives h's error when it is released.
+func handleErrs(h *Handle) <-chan error {
 	errs := make(chan error, 1)
-
 	go func() {
 		defer close(errs)
-		ticker := time.NewTicker(opts.pingInterval)
-		defer ticker.Stop()
-		var lErr error
-		for lErr == nil {
-			select {
-			case <-ctx.Done():
-				lErr = ctx.Err()
-			case <-ticker.C:
-				lErr = conn.PingContext(ctx)
-			}
-		}
-		releaseErr := ignoreErr(releaseLock(conn, lockName))
-		if releaseErr != nil {
-			lErr = releaseErr
-		}
-		errs <- ignoreErr(lErr)
+		<-h.Done()
+		errs <- h.Err()
 	}()
-
-	return errs, nil
+	return errs
 }
 
 var ignoreableErrs = []error{
@@ -96,34 +327,220 @@ func ignoreErr(err error) error {
 	return err
 }
 
-// releaseLock releases the lock named lockName from the given connection
-func releaseLock(conn *sql.Conn, lockName string) error {
+// maxStaleConnRetries is how many times getConn replaces a stale connection before giving up.
+const maxStaleConnRetries = 2
+
+// getConn returns a connection from db for a lock. The connection is pinged first because a connection that sat idle
+// in the pool may have been closed by the server, and a stale connection is replaced with a fresh one instead of
+// failing the lock with driver.ErrBadConn.
+func getConn(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	for retries := 0; ; retries++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = conn.PingContext(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		// closing a conn after driver.ErrBadConn discards it instead of returning it to the pool
+		_ = conn.Close() //nolint:errcheck
+		if err != driver.ErrBadConn || retries >= maxStaleConnRetries {
+			return nil, err
+		}
+	}
+}
+
+// releaseLock releases the lock named lockName from the given connection. RELEASE_LOCK() is bounded by the
+// WithReleaseTimeout value. It uses the prepared statement from stmts when there is one, and closes stmts.
+func releaseLock(conn *sql.Conn, lockName string, opts *lockOpts, stmts *lockStmts) error {
 	// use our own context so we can attempt to release a lock even after the calling function's context has been closed
 	ctx := context.Background()
-	_, err := conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, lockName)
+	if opts.releaseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.releaseTimeout)
+		defer cancel()
+	}
+	var err error
+	if stmts != nil && stmts.releaseAll {
+		err = releaseAllLocks(ctx, conn, []string{lockName}, opts)
+	} else if stmts != nil && stmts.release != nil {
+		_, err = stmts.release.ExecContext(ctx, lockName)
+	} else {
+		_, err = conn.ExecContext(ctx, opts.commented(ctx, lockName, releaseQuery), lockName)
+	}
 	// if the connection is already closed, then the lock is already released and we shouldn't return an error
-	if err == driver.ErrBadConn {
+	if isBadConn(err) {
 		err = nil
 	}
+	if err == nil && stmts != nil && stmts.restoreSession != "" {
+		_, _ = conn.ExecContext(ctx, stmts.restoreSession) //nolint:errcheck
+	}
+	stmts.close()
 	closeErr := conn.Close()
-	if err == nil {
+	if err == nil && !isBadConn(closeErr) {
 		err = closeErr
 	}
 	return err
 }
 
+// newOwnerToken returns a random token identifying one acquisition of a lock.
+func newOwnerToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// setOwner stores token and ownerID in the @mysqllocker_token and @mysqllocker_owner session variables on conn.
+func setOwner(ctx context.Context, conn *sql.Conn, token, ownerID string) error {
+	_, err := conn.ExecContext(ctx, `SET @mysqllocker_token = ?, @mysqllocker_owner = ?`, token, ownerID)
+	return err
+}
+
+// checkLock uses the prepared checkQuery stmt to check lockName. It returns a *LostError when the statement's
+// connection doesn't hold lockName or a *ConnError when it can't check.
+// Matching connection ids aren't enough to prove that the connection is still the session that got the lock because
+// a proxy or failover can hand out a new session with a reused id, so it also checks that the session's
+// @mysqllocker_token is token.
+func checkLock(ctx context.Context, stmt *sql.Stmt, lockName, token string) error {
+	var connectionID int64
+	var owner sql.NullInt64
+	var sessionToken sql.NullString
+	err := stmt.QueryRowContext(ctx, lockName).Scan(&connectionID, &owner, &sessionToken)
+	if err != nil {
+		return &ConnError{LockName: lockName, Err: err}
+	}
+	if owner.Int64 != connectionID || sessionToken.String != token {
+		return &LostError{LockName: lockName, Owner: owner.Int64}
+	}
+	return nil
+}
+
 // getLock attempts GET_LOCK on the given conn.  Does not attempt to hold the lock.
-func getLock(ctx context.Context, conn *sql.Conn, lockName string, timeout time.Duration) (bool, error) {
-	waitSeconds := 0
-	var cancel context.CancelFunc
-	if timeout > 0 {
-		waitSeconds = -1
-		ctx, cancel = context.WithTimeout(ctx, timeout)
+func getLock(ctx context.Context, conn *sql.Conn, lockName string, opts *lockOpts) (bool, error) {
+	defer traceWait(ctx, lockName).End()
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
 		defer cancel()
 	}
-	var gotLock sql.NullBool
-	row := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, lockName, waitSeconds)
-	err := row.Scan(&gotLock)
-	// needs to be both Valid and true to return true
-	return gotLock.Valid && gotLock.Bool, err
+	waitSeconds := lockWait(ctx, opts)
+	if waitSeconds != 0 && opts.progress != nil && opts.progressInterval > 0 {
+		stop := reportProgress(opts.progressInterval, opts.progress)
+		defer stop()
+	}
+	query := opts.commented(ctx, lockName, `SELECT GET_LOCK(?, ?)`)
+	if waitSeconds == 0 || opts.waitSlice <= 0 {
+		var gotLock sql.NullBool
+		err := conn.QueryRowContext(ctx, query, lockName, waitSeconds).Scan(&gotLock)
+		return getLockResult(lockName, gotLock, err)
+	}
+	for {
+		// Each slice runs to the end instead of being canceled with ctx, so the connection isn't killed mid-query.
+		var gotLock sql.NullBool
+		err := conn.QueryRowContext(context.Background(), query, lockName, waitSeconds).Scan(&gotLock)
+		ok, err := getLockResult(lockName, gotLock, err)
+		if err != nil || ok {
+			return ok, err
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		waitSeconds = lockWait(ctx, opts)
+		if waitSeconds == 0 {
+			return false, nil
+		}
+	}
+}
+
+// lockWait returns the GET_LOCK() timeout for one call by a lock with opts. It is 0 with WithNoWait, -1 for no limit
+// with a negative WithTimeout and no ctx deadline, and otherwise lockWaitSeconds(ctx). It is cut to the WithWaitSlice
+// length.
+func lockWait(ctx context.Context, opts *lockOpts) int {
+	if opts.noWait {
+		return 0
+	}
+	waitSeconds := lockWaitSeconds(ctx)
+	if _, hasDeadline := ctx.Deadline(); opts.timeout < 0 && !hasDeadline {
+		waitSeconds = -1
+	}
+	if opts.waitSlice > 0 {
+		sliceSeconds := int(opts.waitSlice / time.Second)
+		if sliceSeconds < 1 {
+			sliceSeconds = 1
+		}
+		if waitSeconds < 0 || waitSeconds > sliceSeconds {
+			waitSeconds = sliceSeconds
+		}
+	}
+	return waitSeconds
+}
+
+// waits returns whether a lock with o waits when it is held by another session, which it does with "WithTimeout" or
+// a ctx deadline unless WithNoWait is set.
+func (o *lockOpts) waits(ctx context.Context) bool {
+	_, hasDeadline := ctx.Deadline()
+	return !o.noWait && (o.timeout != 0 || hasDeadline)
+}
+
+// getLockResult turns the result of GET_LOCK() for lockName into whether the lock was obtained. NULL is a
+// *GetLockError.
+func getLockResult(lockName string, gotLock sql.NullBool, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	if !gotLock.Valid {
+		return false, &GetLockError{LockName: lockName}
+	}
+	return gotLock.Bool, nil
+}
+
+// lockWaitMargin is how much sooner than ctx's deadline GET_LOCK() is told to give up, so the server stops waiting
+// before the client does.
+const lockWaitMargin = 100 * time.Millisecond
+
+// lockWaitSeconds returns the GET_LOCK() timeout for ctx so the server stops waiting when the client does instead of
+// the statement outliving ctx. It is 0, for no waiting, when ctx has no deadline. Otherwise, it is the whole seconds
+// until lockWaitMargin before the deadline. GET_LOCK() can't wait less than a second, so it is 1 when there is less
+// than a second left.
+func lockWaitSeconds(ctx context.Context) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	remaining := time.Until(deadline) - lockWaitMargin
+	if remaining <= 0 {
+		return 0
+	}
+	if remaining < time.Second {
+		return 1
+	}
+	return int(remaining / time.Second)
+}
+
+// reportProgress calls progress every interval until the returned func is called.
+func reportProgress(interval time.Duration, progress func(elapsed time.Duration)) func() {
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				progress(time.Since(start))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
 }
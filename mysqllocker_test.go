@@ -3,72 +3,25 @@ package mysqllocker
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"io/ioutil"
-	"log"
+	"errors"
 	"math/rand"
-	"os"
-	"os/exec"
-	"strings"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-var (
-	_mysqlAddr string
-	setupOnce  sync.Once
-)
-
-func mysqlAddr(t *testing.T) string {
-	t.Helper()
-	setupOnce.Do(func() {
-		_mysqlAddr = os.Getenv("MYSQL_ADDR")
-		if _mysqlAddr != "" {
-			return
-		}
-		out, err := exec.Command("docker-compose", "port", "mysql", "3306").Output()
-		require.NoError(t, err)
-		_mysqlAddr = strings.TrimSpace(string(out))
-		require.NoError(t, mysql.SetLogger(log.New(ioutil.Discard, "", 0)))
-	})
-	return _mysqlAddr
-}
-
-func getDB(t *testing.T) *sql.DB {
-	t.Helper()
-	addr := mysqlAddr(t)
-	db, err := sql.Open("mysql", fmt.Sprintf("root:@tcp(%s)/", addr))
-	require.NoError(t, err)
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	for ctx.Err() == nil {
-		err = db.Ping()
-		if err == nil {
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
-	}
-	require.NoError(t, err, "timed out waiting for connection")
-	t.Cleanup(func() {
-		require.NoError(t, db.Close())
-	})
-	return db
-}
-
 func TestLock(t *testing.T) {
 	t.Run("locks", func(t *testing.T) {
 		t.Parallel()
 		lockName := t.Name()
-		db := getDB(t)
+		db := testdb.DB(t)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		errs, err := Lock(ctx, db, lockName, WithPingInterval(10*time.Millisecond))
@@ -82,7 +35,7 @@ func TestLock(t *testing.T) {
 	t.Run("can't get the same lock twice", func(t *testing.T) {
 		t.Parallel()
 		lockName := t.Name()
-		db := getDB(t)
+		db := testdb.DB(t)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		_, err := Lock(ctx, db, lockName)
@@ -95,7 +48,7 @@ func TestLock(t *testing.T) {
 	t.Run("waits for lock", func(t *testing.T) {
 		t.Parallel()
 		lockName := t.Name()
-		db := getDB(t)
+		db := testdb.DB(t)
 		ctx1, cancel1 := context.WithTimeout(context.Background(), 200*time.Millisecond)
 		defer cancel1()
 		errs1, err := Lock(ctx1, db, lockName)
@@ -117,7 +70,7 @@ func TestLock(t *testing.T) {
 	t.Run("times out waiting for lock", func(t *testing.T) {
 		t.Parallel()
 		lockName := t.Name()
-		db := getDB(t)
+		db := testdb.DB(t)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		_, err := Lock(ctx, db, lockName)
@@ -131,10 +84,34 @@ func TestLock(t *testing.T) {
 		require.Greater(t, int64(delta), int64(timeout))
 	})
 
+	t.Run("reports wait progress", func(t *testing.T) {
+		t.Parallel()
+		lockName := t.Name()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, err := Lock(ctx, db, lockName)
+		require.NoError(t, err)
+		var mux sync.Mutex
+		var reports []time.Duration
+		_, err = Lock(ctx, db, lockName,
+			WithTimeout(100*time.Millisecond),
+			WithWaitProgress(20*time.Millisecond, func(elapsed time.Duration) {
+				mux.Lock()
+				reports = append(reports, elapsed)
+				mux.Unlock()
+			}),
+		)
+		require.Error(t, err)
+		mux.Lock()
+		defer mux.Unlock()
+		require.NotEmpty(t, reports)
+	})
+
 	t.Run("release and relock", func(t *testing.T) {
 		t.Parallel()
 		lockName := t.Name()
-		db := getDB(t)
+		db := testdb.DB(t)
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		errs, err := Lock(ctx, db, lockName)
@@ -151,3 +128,140 @@ func TestLock(t *testing.T) {
 		require.NoError(t, <-errs)
 	})
 }
+
+func TestLockOptsLostAfter(t *testing.T) {
+	for _, td := range []struct {
+		options  []LockOption
+		failures int
+		failing  time.Duration
+		want     bool
+	}{
+		{failures: 1, want: true},
+		{options: []LockOption{WithFailureThreshold(3)}, failures: 2, failing: time.Hour, want: false},
+		{options: []LockOption{WithFailureThreshold(3)}, failures: 3, want: true},
+		{options: []LockOption{WithGracePeriod(time.Second)}, failures: 100, failing: time.Millisecond, want: false},
+		{options: []LockOption{WithGracePeriod(time.Second)}, failures: 2, failing: time.Second, want: true},
+		{options: []LockOption{WithFailureThreshold(3), WithGracePeriod(time.Second)}, failures: 3, want: true},
+		{options: []LockOption{WithFailureThreshold(3), WithGracePeriod(time.Second)}, failures: 1, failing: time.Second, want: true},
+	} {
+		require.Equal(t, td.want, newLockOpts(td.options).lostAfter(td.failures, td.failing))
+	}
+}
+
+func TestNextPingInterval(t *testing.T) {
+	opts := newLockOpts(nil)
+	require.Equal(t, time.Second, opts.nextPingInterval(time.Second, time.Minute, true))
+
+	opts = newLockOpts([]LockOption{WithAdaptivePingInterval(time.Second, 10*time.Second)})
+	require.Equal(t, 1250*time.Millisecond, opts.nextPingInterval(time.Second, time.Millisecond, false))
+	require.Equal(t, 10*time.Second, opts.nextPingInterval(9*time.Second, time.Millisecond, false))
+	require.Equal(t, 2*time.Second, opts.nextPingInterval(4*time.Second, time.Millisecond, true))
+	require.Equal(t, 2*time.Second, opts.nextPingInterval(4*time.Second, time.Second, false))
+	require.Equal(t, time.Second, opts.nextPingInterval(time.Second, time.Second, true))
+	require.Equal(t, 10*time.Second, opts.clampPingInterval(time.Minute))
+}
+
+func TestLockWaitSeconds(t *testing.T) {
+	require.Equal(t, 0, lockWaitSeconds(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Equal(t, 4, lockWaitSeconds(ctx))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	require.Equal(t, 1, lockWaitSeconds(ctx))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, 0, lockWaitSeconds(ctx))
+}
+
+func TestLockWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Equal(t, 4, lockWait(ctx, newLockOpts(nil)))
+	require.Equal(t, 0, lockWait(ctx, newLockOpts([]LockOption{WithNoWait()})))
+	require.Equal(t, 2, lockWait(ctx, newLockOpts([]LockOption{WithWaitSlice(2 * time.Second)})))
+	require.Equal(t, 1, lockWait(ctx, newLockOpts([]LockOption{WithWaitSlice(time.Millisecond)})))
+	require.Equal(t, 0, lockWait(context.Background(), newLockOpts(nil)))
+	require.Equal(t, -1, lockWait(context.Background(), newLockOpts([]LockOption{WithTimeout(-1)})))
+	require.Equal(t, 2, lockWait(context.Background(), newLockOpts([]LockOption{WithTimeout(-1), WithWaitSlice(2 * time.Second)})))
+	require.Equal(t, 4, lockWait(ctx, newLockOpts([]LockOption{WithTimeout(-1)})))
+
+	require.True(t, newLockOpts(nil).waits(ctx))
+	require.False(t, newLockOpts([]LockOption{WithNoWait()}).waits(ctx))
+	require.False(t, newLockOpts(nil).waits(context.Background()))
+	require.True(t, newLockOpts([]LockOption{WithTimeout(time.Second)}).waits(context.Background()))
+}
+
+func TestGetLockResult(t *testing.T) {
+	ok, err := getLockResult("a", sql.NullBool{Valid: true, Bool: true}, nil)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = getLockResult("a", sql.NullBool{Valid: true}, nil)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = getLockResult("a", sql.NullBool{}, nil)
+	require.False(t, ok)
+	require.Equal(t, &GetLockError{LockName: "a"}, err)
+	require.True(t, IsTransient(err))
+}
+
+func TestTimeoutError(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	h, err := Acquire(ctx, db, lockName)
+	require.NoError(t, err)
+	_, err = Acquire(ctx, db, lockName, WithTimeout(time.Second))
+	var timeoutErr *TimeoutError
+	require.True(t, errors.As(err, &timeoutErr))
+	require.Equal(t, lockName, timeoutErr.LockName)
+	require.False(t, IsTransient(err))
+	require.NoError(t, h.Release())
+}
+
+func TestSetDefaultOptions(t *testing.T) {
+	SetDefaultOptions(WithPingInterval(time.Second), WithTimeout(time.Minute))
+	defer SetDefaultOptions()
+	opts := newLockOpts([]LockOption{WithTimeout(time.Second)})
+	require.Equal(t, time.Second, opts.pingInterval)
+	require.Equal(t, time.Second, opts.timeout)
+
+	locker := NewLocker(nil, WithDefaults(WithPingInterval(2*time.Second)))
+	opts = newLockOpts(locker.options(nil))
+	require.Equal(t, 2*time.Second, opts.pingInterval)
+	require.Equal(t, time.Minute, opts.timeout)
+
+	SetDefaultOptions()
+	require.Equal(t, defaultPingInterval, newLockOpts(nil).pingInterval)
+}
+
+func TestWithWaitSlice(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	h, err := Acquire(ctx, db, lockName)
+	require.NoError(t, err)
+
+	// cancellation takes effect at the end of the current slice
+	waitCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = Acquire(waitCtx, db, lockName, WithWaitSlice(time.Second))
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(2*time.Second))
+
+	// a lock released between slices is acquired
+	time.AfterFunc(1500*time.Millisecond, func() {
+		_ = h.Release() //nolint:errcheck
+	})
+	h, err = Acquire(ctx, db, lockName, WithTimeout(time.Minute), WithWaitSlice(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+}
@@ -0,0 +1,64 @@
+package mysqllocker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// MaxLockNameLength is the longest lock name mysql accepts.
+const MaxLockNameLength = 64
+
+// lockNameSeparator separates parts of a LockName
+const lockNameSeparator = "/"
+
+// LockName builds hierarchical lock names like "tenant/42/reports" so code across a project constructs names the
+// same way.
+type LockName struct {
+	parts []string
+}
+
+// Name returns a LockName made of parts.
+func Name(parts ...string) LockName {
+	return LockName{
+		parts: append([]string(nil), parts...),
+	}
+}
+
+// Child returns a LockName with parts appended to n.
+func (n LockName) Child(parts ...string) LockName {
+	return LockName{
+		parts: append(n.parts[:len(n.parts):len(n.parts)], parts...),
+	}
+}
+
+// Parent returns n without its last part. It returns false when n has no parent.
+func (n LockName) Parent() (LockName, bool) {
+	if len(n.parts) < 2 {
+		return LockName{}, false
+	}
+	return LockName{parts: n.parts[:len(n.parts)-1]}, true
+}
+
+// String returns the lock name. Parts are joined with "/" and escaped, so a part containing "/" can't be confused
+// with two parts. Names longer than MaxLockNameLength are shortened by replacing the end with a hash of the full
+// name.
+func (n LockName) String() string {
+	escaped := make([]string, len(n.parts))
+	for i, part := range n.parts {
+		escaped[i] = url.PathEscape(part)
+	}
+	return shortenLockName(strings.Join(escaped, lockNameSeparator))
+}
+
+// shortenLockName returns name if it fits in MaxLockNameLength. Otherwise, it returns a prefix of name followed by
+// "#" and part of the name's sha256 hash.
+func shortenLockName(name string) string {
+	if len(name) <= MaxLockNameLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:16]
+	return name[:MaxLockNameLength-len(hash)-1] + "#" + hash
+}
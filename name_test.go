@@ -0,0 +1,30 @@
+package mysqllocker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockName(t *testing.T) {
+	name := Name("tenant", "42").Child("reports").Child("job/1")
+	require.Equal(t, "tenant/42/reports/job%2F1", name.String())
+
+	parent, ok := name.Parent()
+	require.True(t, ok)
+	require.Equal(t, "tenant/42/reports", parent.String())
+	_, ok = Name("tenant").Parent()
+	require.False(t, ok)
+
+	// children don't share parts with each other
+	base := Name("a", "b")
+	c1 := base.Child("c1")
+	c2 := base.Child("c2")
+	require.Equal(t, "a/b/c1", c1.String())
+	require.Equal(t, "a/b/c2", c2.String())
+
+	long := Name(strings.Repeat("x", 40), strings.Repeat("y", 40))
+	require.Len(t, long.String(), MaxLockNameLength)
+	require.NotEqual(t, long.String(), Name(strings.Repeat("x", 40), strings.Repeat("z", 40)).String())
+}
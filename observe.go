@@ -0,0 +1,144 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const defaultPollInterval = time.Second
+
+type observeOpts struct {
+	pollInterval time.Duration
+}
+
+// ObserveOption is an optional value for Observe
+type ObserveOption func(*observeOpts)
+
+// WithPollInterval sets how often Observe checks the lock. Default is 1 second.
+func WithPollInterval(pollInterval time.Duration) ObserveOption {
+	return func(o *observeOpts) {
+		o.pollInterval = pollInterval
+	}
+}
+
+// OwnerChange is sent by Observe when a lock's owner changes.
+type OwnerChange struct {
+	// ConnectionID is the mysql connection id of the session holding the lock. It is 0 when the lock is free.
+	ConnectionID int64
+	// Time is when the change was observed.
+	Time time.Time
+}
+
+// Free returns true when the lock is not held by any session.
+func (c OwnerChange) Free() bool {
+	return c.ConnectionID == 0
+}
+
+// Observe follows a named lock without contending for it. It polls IS_USED_LOCK() and sends an OwnerChange
+// with the current owner, then another each time the owner changes or the lock becomes free.
+// Errors from polling after the first check are ignored and the check is retried on the next poll.
+// The returned channel is closed when ctx is canceled.
+func Observe(ctx context.Context, db *sql.DB, lockName string, options ...ObserveOption) (<-chan OwnerChange, error) {
+	opts := &observeOpts{
+		pollInterval: defaultPollInterval,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	owner, err := lockOwnerID(ctx, db, lockName)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan OwnerChange, 1)
+	changes <- OwnerChange{
+		ConnectionID: owner,
+		Time:         time.Now(),
+	}
+
+	go func() {
+		defer close(changes)
+		ticker := time.NewTicker(opts.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			newOwner, err := lockOwnerID(ctx, db, lockName)
+			if err != nil || newOwner == owner {
+				continue
+			}
+			owner = newOwner
+			select {
+			case <-ctx.Done():
+				return
+			case changes <- OwnerChange{ConnectionID: owner, Time: time.Now()}:
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// lockOwnerID returns the connection id holding lockName or 0 if the lock is free.
+func lockOwnerID(ctx context.Context, db *sql.DB, lockName string) (int64, error) {
+	var owner sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT IS_USED_LOCK(?)`, lockName).Scan(&owner)
+	return owner.Int64, err
+}
+
+const minSubscribePollInterval = 10 * time.Millisecond
+
+// Subscribe sends on the returned channel each time lockName is released. It polls IS_USED_LOCK() adaptively,
+// starting fast after each change and backing off to the WithPollInterval value while nothing changes.
+// Signals are coalesced, so a slow reader sees one signal for several releases. The channel is closed when ctx is
+// canceled.
+func Subscribe(ctx context.Context, db *sql.DB, lockName string, options ...ObserveOption) (<-chan struct{}, error) {
+	opts := &observeOpts{
+		pollInterval: defaultPollInterval,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	owner, err := lockOwnerID(ctx, db, lockName)
+	if err != nil {
+		return nil, err
+	}
+	released := make(chan struct{}, 1)
+
+	go func() {
+		defer close(released)
+		interval := minSubscribePollInterval
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			newOwner, err := lockOwnerID(ctx, db, lockName)
+			switch {
+			case err != nil || newOwner == owner:
+				interval *= 2
+				if interval > opts.pollInterval {
+					interval = opts.pollInterval
+				}
+			default:
+				if newOwner == 0 {
+					select {
+					case released <- struct{}{}:
+					default:
+					}
+				}
+				owner = newOwner
+				interval = minSubscribePollInterval
+			}
+			timer.Reset(interval)
+		}
+	}()
+
+	return released, nil
+}
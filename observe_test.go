@@ -0,0 +1,61 @@
+package mysqllocker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestObserve(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := Observe(ctx, db, lockName, WithPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, (<-changes).Free())
+
+	lockCtx, lockCancel := context.WithCancel(context.Background())
+	defer lockCancel()
+	errs, err := Lock(lockCtx, db, lockName)
+	require.NoError(t, err)
+	require.False(t, (<-changes).Free())
+
+	lockCancel()
+	require.NoError(t, <-errs)
+	require.True(t, (<-changes).Free())
+
+	cancel()
+	for range changes {
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lockCtx, lockCancel := context.WithCancel(ctx)
+	defer lockCancel()
+	errs, err := Lock(lockCtx, db, lockName)
+	require.NoError(t, err)
+
+	released, err := Subscribe(ctx, db, lockName, WithPollInterval(50*time.Millisecond))
+	require.NoError(t, err)
+	select {
+	case <-released:
+		t.Fatal("unexpected release signal")
+	case <-time.After(100 * time.Millisecond):
+	}
+	lockCancel()
+	require.NoError(t, <-errs)
+	<-released
+	cancel()
+	for range released {
+	}
+}
@@ -0,0 +1,119 @@
+package mysqllocker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// LexicalLockOrder orders locks by name. It is the order LockMany uses when the Locker has no WithLockOrder policy.
+func LexicalLockOrder(a, b string) bool {
+	return a < b
+}
+
+// WithLockOrder sets a policy for the order locks must be acquired in to avoid deadlocks between processes that
+// need more than one lock. less reports whether lock a must be acquired before lock b. Names passed to less include
+// the Locker's namespace.
+//
+// Locker.LockMany acquires locks in this order. Locker.Acquire and Locker.Lock return a *LockOrderError instead of
+// waiting for a lock that must come before a lock already held by ctx. Use ContextWithLock to record held locks
+// in a context.
+func WithLockOrder(less func(a, b string) bool) LockerOption {
+	return func(l *Locker) {
+		l.less = less
+	}
+}
+
+// LockOrderError is returned when acquiring a lock would violate a Locker's WithLockOrder policy.
+type LockOrderError struct {
+	// Held is the name of the lock that is already held.
+	Held string
+	// Requested is the name of the lock that must be acquired before Held.
+	Requested string
+}
+
+func (e *LockOrderError) Error() string {
+	return fmt.Sprintf("lock %q must be acquired before lock %q", e.Requested, e.Held)
+}
+
+type heldLocksKey struct{}
+
+// ContextWithLock returns a copy of ctx that records that h is held for checking lock order when acquiring more
+// locks from a Locker with WithLockOrder.
+func ContextWithLock(ctx context.Context, h *Handle) context.Context {
+	held := heldLocks(ctx)
+	return context.WithValue(ctx, heldLocksKey{}, append(held[:len(held):len(held)], h.Name()))
+}
+
+// heldLocks returns the names of locks recorded by ContextWithLock.
+func heldLocks(ctx context.Context) []string {
+	held, _ := ctx.Value(heldLocksKey{}).([]string) //nolint:errcheck
+	return held
+}
+
+// checkOrder returns a *LockOrderError if lockName must be acquired before any lock held by ctx.
+func (l *Locker) checkOrder(ctx context.Context, lockName string) error {
+	if l.less == nil {
+		return nil
+	}
+	for _, held := range heldLocks(ctx) {
+		if !l.less(held, lockName) {
+			return &LockOrderError{Held: held, Requested: lockName}
+		}
+	}
+	return nil
+}
+
+// LockMany acquires all of names in the Locker's lock order, so processes that need the same set of locks can't
+// deadlock each other. A name given more than once is acquired once. The returned handles are in the order they were
+// acquired. If any lock can't be acquired, locks acquired so far are released before returning the error.
+func (l *Locker) LockMany(ctx context.Context, names []string, options ...LockOption) ([]*Handle, error) {
+	less := l.less
+	if less == nil {
+		less = LexicalLockOrder
+	}
+	ordered := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = l.name(name)
+		if !seen[name] {
+			seen[name] = true
+			ordered = append(ordered, name)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return less(ordered[i], ordered[j])
+	})
+
+	holdCtx, cancel := context.WithCancel(ctx)
+	handles := make([]*Handle, 0, len(ordered))
+	release := func() {
+		cancel()
+		for _, h := range handles {
+			<-h.Done()
+		}
+	}
+	for _, name := range ordered {
+		err := l.checkOrder(ctx, name)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		opts := l.options(options)
+		h, err := l.withSlot(ctx, opts, func() (*Handle, error) {
+			return Acquire(holdCtx, l.db, name, opts...)
+		})
+		if err != nil {
+			release()
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	go func() {
+		for _, h := range handles {
+			<-h.Done()
+		}
+		cancel()
+	}()
+	return handles, nil
+}
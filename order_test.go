@@ -0,0 +1,49 @@
+package mysqllocker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithLockOrder(t *testing.T) {
+	t.Run("LockMany acquires in order", func(t *testing.T) {
+		t.Parallel()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		locker := NewLocker(db, WithNamespace(t.Name()))
+		handles, err := locker.LockMany(ctx, []string{"c", "a", "b", "a"})
+		require.NoError(t, err)
+		require.Len(t, handles, 3)
+		for i, name := range []string{"a", "b", "c"} {
+			require.Equal(t, t.Name()+":"+name, handles[i].Name())
+		}
+		cancel()
+		for _, h := range handles {
+			<-h.Done()
+			require.NoError(t, h.Err())
+		}
+	})
+
+	t.Run("errors on out of order acquisition", func(t *testing.T) {
+		t.Parallel()
+		db := testdb.DB(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		locker := NewLocker(db, WithNamespace(t.Name()), WithLockOrder(LexicalLockOrder))
+		h, err := locker.Acquire(ctx, "b")
+		require.NoError(t, err)
+		ctx = ContextWithLock(ctx, h)
+		_, err = locker.Acquire(ctx, "c")
+		require.NoError(t, err)
+		_, err = locker.Acquire(ctx, "a")
+		var orderErr *LockOrderError
+		require.True(t, errors.As(err, &orderErr))
+		require.Equal(t, t.Name()+":b", orderErr.Held)
+		require.Equal(t, t.Name()+":a", orderErr.Requested)
+	})
+}
@@ -0,0 +1,213 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LockOwner describes the session holding a lock.
+type LockOwner struct {
+	// ConnectionID is the mysql connection id of the session holding the lock.
+	ConnectionID int64
+	// User is the mysql user of the session.
+	User string
+	// Host is the host and port the session connected from.
+	Host string
+	// CommandTime is how long the session has been in its current state.
+	CommandTime time.Duration
+}
+
+// GetLockOwner returns details about the session holding lockName from information_schema.processlist.
+// It returns nil when the lock is free. The user needs the PROCESS privilege to see sessions belonging to other users.
+// Without it, a lock held by another user's session returns an *UnsupportedError.
+func GetLockOwner(ctx context.Context, db *sql.DB, lockName string) (*LockOwner, error) {
+	var owner LockOwner
+	var connectionID sql.NullInt64
+	var user, host sql.NullString
+	var seconds sql.NullInt64
+	row := db.QueryRowContext(ctx, `
+SELECT l.ID, p.USER, p.HOST, p.TIME
+FROM (SELECT IS_USED_LOCK(?) AS ID) l
+LEFT JOIN information_schema.PROCESSLIST p ON p.ID = l.ID`, lockName)
+	err := row.Scan(&connectionID, &user, &host, &seconds)
+	if err != nil {
+		return nil, err
+	}
+	if !connectionID.Valid {
+		return nil, nil
+	}
+	if !user.Valid {
+		return nil, &UnsupportedError{
+			Feature: "GetLockOwner",
+			Err:     fmt.Errorf("connection %d is not visible without the PROCESS privilege", connectionID.Int64),
+		}
+	}
+	owner.ConnectionID = connectionID.Int64
+	owner.User = user.String
+	owner.Host = host.String
+	owner.CommandTime = time.Duration(seconds.Int64) * time.Second
+	return &owner, nil
+}
+
+// CountWaiters returns how many sessions are waiting in GET_LOCK() for lockName. It uses
+// performance_schema.metadata_locks, which needs the "wait/lock/metadata/sql/mdl" instrument enabled (the default
+// from MySQL 8.0).
+func CountWaiters(ctx context.Context, db *sql.DB, lockName string) (int, error) {
+	var waiters int
+	err := db.QueryRowContext(ctx, `
+SELECT COUNT(*) FROM performance_schema.metadata_locks
+WHERE OBJECT_TYPE = 'USER LEVEL LOCK' AND LOCK_STATUS = 'PENDING' AND OBJECT_NAME = ?`, lockName).Scan(&waiters)
+	return waiters, unsupported("CountWaiters", err)
+}
+
+// ServerLock is a named lock that is held or waited for on the server.
+type ServerLock struct {
+	Name string
+	// ConnectionID is the mysql connection id of the session holding the lock. It is 0 when the lock isn't granted to
+	// anyone yet.
+	ConnectionID int64
+	// Waiters is how many sessions are waiting for the lock.
+	Waiters int
+}
+
+// ListLocks returns every named lock on the server that is held or waited for, sorted by name. Like CountWaiters,
+// it uses performance_schema.metadata_locks.
+func ListLocks(ctx context.Context, db *sql.DB) ([]ServerLock, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT ml.OBJECT_NAME,
+  COALESCE(MAX(IF(ml.LOCK_STATUS = 'GRANTED', t.PROCESSLIST_ID, NULL)), 0),
+  SUM(ml.LOCK_STATUS = 'PENDING')
+FROM performance_schema.metadata_locks ml
+JOIN performance_schema.threads t ON t.THREAD_ID = ml.OWNER_THREAD_ID
+WHERE ml.OBJECT_TYPE = 'USER LEVEL LOCK'
+GROUP BY ml.OBJECT_NAME
+ORDER BY ml.OBJECT_NAME`)
+	if err != nil {
+		return nil, unsupported("ListLocks", err)
+	}
+	defer rows.Close() //nolint:errcheck
+	var locks []ServerLock
+	for rows.Next() {
+		var lock ServerLock
+		err = rows.Scan(&lock.Name, &lock.ConnectionID, &lock.Waiters)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, rows.Err()
+}
+
+// BlockerInfo describes the session holding a lock that another session is waiting for or failed to get.
+type BlockerInfo struct {
+	LockName string
+	// ConnectionID is the mysql connection id of the session holding the lock.
+	ConnectionID int64
+	// User is the mysql user of the session.
+	User string
+	// Host is the host and port the session connected from.
+	Host string
+	// OwnerID is the holder's WithOwnerID value. It is empty when the lock wasn't taken by this package.
+	OwnerID string
+	// HeldFor is how long the session has held the lock. It is only known when the lock is audited with WithAudit
+	// and is 0 otherwise.
+	HeldFor time.Duration
+}
+
+// GetBlocker returns details about the session holding lockName by joining performance_schema.metadata_locks,
+// threads and user_variables_by_thread. It returns nil when the lock is free. Like CountWaiters, it needs the
+// "wait/lock/metadata/sql/mdl" instrument enabled. Only the WithAudit option is used from options, to find HeldFor
+// and the owner id of a holder whose session variables aren't visible. When user_variables_by_thread isn't readable,
+// OwnerID only comes from the audit table.
+func GetBlocker(ctx context.Context, db *sql.DB, lockName string, options ...LockOption) (*BlockerInfo, error) {
+	return getBlocker(ctx, db, lockName, newLockOpts(options).auditTable)
+}
+
+// blockerQuery returns the query for a lock's holder. It selects an empty owner id unless withOwner is set.
+func blockerQuery(withOwner bool) string {
+	owner, join := "''", ""
+	if withOwner {
+		owner = "COALESCE(v.VARIABLE_VALUE, '')"
+		join = `
+LEFT JOIN performance_schema.user_variables_by_thread v
+  ON v.THREAD_ID = t.THREAD_ID AND v.VARIABLE_NAME = 'mysqllocker_owner'`
+	}
+	return `
+SELECT t.PROCESSLIST_ID, COALESCE(t.PROCESSLIST_USER, ''), COALESCE(t.PROCESSLIST_HOST, ''), ` + owner + `
+FROM performance_schema.metadata_locks ml
+JOIN performance_schema.threads t ON t.THREAD_ID = ml.OWNER_THREAD_ID` + join + `
+WHERE ml.OBJECT_TYPE = 'USER LEVEL LOCK' AND ml.LOCK_STATUS = 'GRANTED' AND ml.OBJECT_NAME = ?`
+}
+
+// getBlocker implements GetBlocker. auditTable is the WithAudit table or empty.
+func getBlocker(ctx context.Context, db *sql.DB, lockName, auditTable string) (*BlockerInfo, error) {
+	blocker := BlockerInfo{LockName: lockName}
+	err := db.QueryRowContext(ctx, blockerQuery(true), lockName).Scan(
+		&blocker.ConnectionID, &blocker.User, &blocker.Host, &blocker.OwnerID,
+	)
+	if errors.Is(unsupported("", err), ErrUnsupported) {
+		// try again without the owner id in case only user_variables_by_thread is off limits
+		err = db.QueryRowContext(ctx, blockerQuery(false), lockName).Scan(
+			&blocker.ConnectionID, &blocker.User, &blocker.Host, &blocker.OwnerID,
+		)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, unsupported("GetBlocker", err)
+	}
+	if auditTable == "" {
+		return &blocker, nil
+	}
+	var holder string
+	var micros int64
+	row := db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT holder, TIMESTAMPDIFF(MICROSECOND, created_at, NOW(6)) FROM %s
+WHERE lock_name = ? AND connection_id = ? AND event IN ('acquire', 'takeover')
+ORDER BY created_at DESC LIMIT 1`, auditTable), lockName, blocker.ConnectionID)
+	err = row.Scan(&holder, &micros)
+	if err == sql.ErrNoRows {
+		return &blocker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if blocker.OwnerID == "" {
+		blocker.OwnerID = holder
+	}
+	blocker.HeldFor = time.Duration(micros) * time.Microsecond
+	return &blocker, nil
+}
+
+// blockerLookupTimeout bounds the GetBlocker call for WithBlockerDiagnostics.
+const blockerLookupTimeout = 5 * time.Second
+
+// WithBlockerDiagnostics makes a failed acquisition look up the session holding the lock with GetBlocker and return
+// a *BlockedError describing it, so logs show who had the lock. This applies when the lock is held by another
+// session and when waiting for it times out. WithAudit also applies to the lookup. When the lookup fails or finds the
+// lock free, the usual error is returned.
+func WithBlockerDiagnostics() LockOption {
+	return func(o *lockOpts) {
+		o.diagnoseBlocker = true
+	}
+}
+
+// blockedError returns a *BlockedError for lockName when WithBlockerDiagnostics is set and the lock's holder can
+// be found. Otherwise, it returns nil.
+func blockedError(db *sql.DB, lockName string, opts *lockOpts, err error) error {
+	if !opts.diagnoseBlocker {
+		return nil
+	}
+	// the caller's context has often expired by now
+	ctx, cancel := context.WithTimeout(context.Background(), blockerLookupTimeout)
+	defer cancel()
+	blocker, lookupErr := getBlocker(ctx, db, lockName, opts.auditTable)
+	if lookupErr != nil || blocker == nil {
+		return nil
+	}
+	return &BlockedError{LockName: lockName, Blocker: *blocker, Err: err}
+}
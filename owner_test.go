@@ -0,0 +1,126 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestGetLockOwner(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	owner, err := GetLockOwner(ctx, db, lockName)
+	require.NoError(t, err)
+	require.Nil(t, owner)
+
+	_, err = Lock(ctx, db, lockName)
+	require.NoError(t, err)
+	owner, err = GetLockOwner(ctx, db, lockName)
+	require.NoError(t, err)
+	require.NotNil(t, owner)
+	require.NotZero(t, owner.ConnectionID)
+	require.Equal(t, "root", owner.User)
+}
+
+func TestCountWaiters(t *testing.T) {
+	enableMDLInstrument(t)
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := Lock(ctx, db, lockName)
+	require.NoError(t, err)
+	waiters, err := CountWaiters(ctx, db, lockName)
+	require.NoError(t, err)
+	require.Zero(t, waiters)
+
+	go func() {
+		_, _ = Lock(ctx, db, lockName, WithTimeout(time.Minute)) //nolint:errcheck
+	}()
+	require.Eventually(t, func() bool {
+		waiters, err = CountWaiters(ctx, db, lockName)
+		return err == nil && waiters == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestListLocks(t *testing.T) {
+	enableMDLInstrument(t)
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := Acquire(ctx, db, lockName)
+	require.NoError(t, err)
+	go func() {
+		_, _ = Lock(ctx, db, lockName, WithTimeout(time.Minute)) //nolint:errcheck
+	}()
+	require.Eventually(t, func() bool {
+		locks, err := ListLocks(ctx, db)
+		if err != nil {
+			return false
+		}
+		for _, lock := range locks {
+			if lock.Name == lockName {
+				return lock.ConnectionID != 0 && lock.Waiters == 1
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, h.Release())
+}
+
+func TestGetBlocker(t *testing.T) {
+	enableMDLInstrument(t)
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	blocker, err := GetBlocker(ctx, db, lockName)
+	require.NoError(t, err)
+	require.Nil(t, blocker)
+
+	h, err := Acquire(ctx, db, lockName, WithOwnerID("blocker-test"))
+	require.NoError(t, err)
+	defer h.Release() //nolint:errcheck
+	var connectionID int64
+	require.NoError(t, h.Conn(func(conn *sql.Conn) error {
+		return conn.QueryRowContext(ctx, `SELECT CONNECTION_ID()`).Scan(&connectionID)
+	}))
+	blocker, err = GetBlocker(ctx, db, lockName)
+	require.NoError(t, err)
+	require.Equal(t, lockName, blocker.LockName)
+	require.Equal(t, connectionID, blocker.ConnectionID)
+	require.Equal(t, "blocker-test", blocker.OwnerID)
+	require.NotEmpty(t, blocker.User)
+}
+
+func TestWithBlockerDiagnostics(t *testing.T) {
+	enableMDLInstrument(t)
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	h, err := Acquire(ctx, db, lockName, WithOwnerID("blocker-test"))
+	require.NoError(t, err)
+	defer h.Release() //nolint:errcheck
+
+	_, err = Acquire(ctx, db, lockName, WithBlockerDiagnostics())
+	var blockedErr *BlockedError
+	require.True(t, errors.As(err, &blockedErr))
+	require.Equal(t, "blocker-test", blockedErr.Blocker.OwnerID)
+	require.Equal(t, &TimeoutError{LockName: lockName}, blockedErr.Err)
+	require.NotContains(t, err.Error(), "another session")
+
+	// GET_LOCK() waits at least a second, so the context times out first
+	waitCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	_, err = Acquire(waitCtx, db, lockName, WithBlockerDiagnostics())
+	require.True(t, errors.As(err, &blockedErr))
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
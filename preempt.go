@@ -0,0 +1,127 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DefaultPreemptionTable is the table for preemption requests when WithPreemptionTable isn't set.
+const DefaultPreemptionTable = "mysqllocker_preemptions"
+
+// PreemptRequest is a request from a higher priority waiter for a lock's holder to give it up.
+type PreemptRequest struct {
+	LockName string
+	// Requester is the waiter's WithOwnerID value.
+	Requester   string
+	Priority    int
+	RequestedAt time.Time
+}
+
+// WithPriority sets the lock's priority. While waiting for the lock, a lock with a priority above 0 asks the holder
+// to give it up by writing a preemption request that holders using WithPreemption see. A holder is only asked by
+// waiters with a higher priority than its own. Default is 0.
+func WithPriority(priority int) LockOption {
+	return func(o *lockOpts) {
+		o.priority = priority
+	}
+}
+
+// WithPreemption calls preempt when a waiter with a higher priority than the lock's asks for it, so the holder can
+// finish up gracefully and release it. Requests are looked for after each regular check of the lock. preempt is called
+// once per request in its own goroutine, so it may call Handle.Release. Nothing is released unless preempt does it.
+func WithPreemption(preempt func(req PreemptRequest)) LockOption {
+	return func(o *lockOpts) {
+		o.preempt = preempt
+	}
+}
+
+// WithPreemptionTable sets the table for preemption requests. Waiters and holders must use the same table. table is
+// used in queries as-is, so it may be qualified with a database name. The table must already exist, such as from
+// EnsureSchema, with at least these columns:
+//
+//	CREATE TABLE mysqllocker_preemptions (
+//	  lock_name VARCHAR(64) NOT NULL,
+//	  request_id VARCHAR(64) NOT NULL,
+//	  requester VARCHAR(255) NOT NULL,
+//	  priority INT NOT NULL,
+//	  requested_at DATETIME(6) NOT NULL,
+//	  expires_at DATETIME(6) NOT NULL,
+//	  PRIMARY KEY (lock_name, request_id)
+//	)
+func WithPreemptionTable(table string) LockOption {
+	return func(o *lockOpts) {
+		o.preemptTable = table
+	}
+}
+
+// preemptTableName returns the WithPreemptionTable value or DefaultPreemptionTable.
+func (o *lockOpts) preemptTableName() string {
+	if o.preemptTable != "" {
+		return o.preemptTable
+	}
+	return DefaultPreemptionTable
+}
+
+// requestPreemption writes a preemption request for a prioritized attempt that will wait for lockName on conn, the
+// connection the attempt waits on, so it doesn't need a second connection from the pool. The returned function
+// withdraws it. The request expires when the attempt stops waiting, so one left by a crashed process is ignored.
+func requestPreemption(ctx context.Context, conn *sql.Conn, lockName string, opts *lockOpts) (func(), error) {
+	wait := opts.timeout
+	if deadline, ok := ctx.Deadline(); ok && (wait <= 0 || time.Until(deadline) < wait) {
+		wait = time.Until(deadline)
+	}
+	if opts.priority <= 0 || opts.noWait || wait <= 0 {
+		return func() {}, nil
+	}
+	requestID, err := newOwnerToken()
+	if err != nil {
+		return nil, err
+	}
+	table := opts.preemptTableName()
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE lock_name = ? AND expires_at < NOW(6)`, table),
+		lockName)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO %s (lock_name, request_id, requester, priority, requested_at, expires_at)
+VALUES (?, ?, ?, ?, NOW(6), NOW(6) + INTERVAL ? MICROSECOND)`, table),
+		lockName, requestID, opts.owner(), opts.priority, wait.Microseconds())
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), fmt.Sprintf(
+			`DELETE FROM %s WHERE lock_name = ? AND request_id = ?`, table), lockName, requestID) //nolint:errcheck
+	}, nil
+}
+
+// checkPreemption calls the WithPreemption function for the highest priority request for the lock that outranks
+// it, unless it was already called for that request. seen is the id of the last request it was called for. It looks
+// on the lock's connection, so it doesn't need a second connection from the pool.
+func (h *Handle) checkPreemption(ctx context.Context, seen string) string {
+	if h.opts.preempt == nil {
+		return seen
+	}
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	if h.released {
+		return seen
+	}
+	var requestID string
+	var requestedAt int64
+	req := PreemptRequest{LockName: h.lockName}
+	err := h.conn.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT request_id, requester, priority, FLOOR(UNIX_TIMESTAMP(requested_at) * 1000000) FROM %s
+WHERE lock_name = ? AND priority > ? AND expires_at > NOW(6)
+ORDER BY priority DESC, requested_at LIMIT 1`, h.opts.preemptTableName()),
+		h.lockName, h.opts.priority).Scan(&requestID, &req.Requester, &req.Priority, &requestedAt)
+	if err != nil || requestID == seen {
+		return seen
+	}
+	req.RequestedAt = time.UnixMicro(requestedAt)
+	go h.opts.preempt(req)
+	return requestID
+}
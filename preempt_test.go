@@ -0,0 +1,105 @@
+package mysqllocker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithPreemption(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.preempt_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	require.NoError(t, EnsureSchema(ctx, db, DefaultTableOptions, WithPreemptionTable(table),
+		WithAudit(table+"_audit"), WithDataTable(table+"_data")))
+
+	requests := make(chan PreemptRequest, 10)
+	holder, err := Acquire(ctx, db, lockName,
+		WithPreemptionTable(table),
+		WithPingInterval(10*time.Millisecond),
+		WithPriority(1),
+		WithPreemption(func(req PreemptRequest) {
+			requests <- req
+		}),
+	)
+	require.NoError(t, err)
+	yielded := make(chan PreemptRequest, 1)
+	go func() {
+		req := <-yielded
+		_ = holder.Release() //nolint:errcheck
+		yielded <- req
+	}()
+
+	// a waiter that doesn't outrank the holder only waits
+	_, err = Acquire(ctx, db, lockName, WithPreemptionTable(table), WithPriority(1), WithTimeout(time.Second))
+	require.Error(t, err)
+	require.Empty(t, yielded)
+
+	h, err := Acquire(ctx, db, lockName,
+		WithPreemptionTable(table),
+		WithPriority(5),
+		WithOwnerID("maintenance"),
+		WithTimeout(5*time.Second),
+	)
+	require.NoError(t, err)
+	req := <-requests
+	require.Equal(t, lockName, req.LockName)
+	require.Equal(t, "maintenance", req.Requester)
+	require.Equal(t, 5, req.Priority)
+	require.NoError(t, holder.Err())
+	require.NoError(t, h.Release())
+
+	var pending int
+	err = db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, table)).Scan(&pending)
+	require.NoError(t, err)
+	require.Zero(t, pending)
+}
+
+func TestWithPreemptionConnector(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.preempt_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	require.NoError(t, EnsureSchema(ctx, db, DefaultTableOptions, WithPreemptionTable(table),
+		WithAudit(table+"_audit"), WithDataTable(table+"_data")))
+	cfg, err := mysql.ParseDSN(fmt.Sprintf("root:@tcp(%s)/", testdb.Addr(t)))
+	require.NoError(t, err)
+	connector, err := mysql.NewConnector(cfg)
+	require.NoError(t, err)
+
+	// requesting and checking for preemption works with only the lock's connection
+	requests := make(chan PreemptRequest, 10)
+	holder, err := AcquireConnector(ctx, connector, lockName,
+		WithPreemptionTable(table),
+		WithPingInterval(10*time.Millisecond),
+		WithPreemption(func(req PreemptRequest) {
+			requests <- req
+		}),
+	)
+	require.NoError(t, err)
+	go func() {
+		<-requests
+		_ = holder.Release() //nolint:errcheck
+	}()
+	h, err := AcquireConnector(ctx, connector, lockName,
+		WithPreemptionTable(table),
+		WithPriority(5),
+		WithTimeout(5*time.Second),
+	)
+	require.NoError(t, err)
+	require.NoError(t, holder.Err())
+	require.NoError(t, h.Release())
+}
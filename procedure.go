@@ -0,0 +1,62 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DefaultCheckProcedure is the stored procedure name InstallCheckProcedure and WithCheckProcedure use when none is
+// given.
+const DefaultCheckProcedure = "mysqllocker_check"
+
+// CheckProcedureSQL returns the CREATE PROCEDURE statement for a procedure named name that does a Handle's regular
+// check. It is for teams that manage DDL through their own migrations instead of InstallCheckProcedure.
+func CheckProcedureSQL(name string) string {
+	if name == "" {
+		name = DefaultCheckProcedure
+	}
+	return fmt.Sprintf(`CREATE PROCEDURE %s(IN lock_name VARCHAR(64))
+SQL SECURITY INVOKER
+SELECT CONNECTION_ID(), IS_USED_LOCK(lock_name), @mysqllocker_token`, name)
+}
+
+// InstallCheckProcedure creates or replaces the stored procedure from CheckProcedureSQL in db's current database.
+func InstallCheckProcedure(ctx context.Context, db *sql.DB, name string) error {
+	if name == "" {
+		name = DefaultCheckProcedure
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`DROP PROCEDURE IF EXISTS %s`, name))
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, CheckProcedureSQL(name))
+	return err
+}
+
+// WithCheckProcedure makes regular checks CALL the stored procedure installed by InstallCheckProcedure, or
+// DefaultCheckProcedure when name is empty. It lets DBAs own the statement that runs on every tick and lets lock
+// users run with only EXECUTE on the procedure. When the procedure isn't in the connection's current database, the
+// usual query is used instead.
+func WithCheckProcedure(name string) LockOption {
+	if name == "" {
+		name = DefaultCheckProcedure
+	}
+	return func(o *lockOpts) {
+		o.checkProcedure = name
+	}
+}
+
+// checkProcedureExists returns whether the WithCheckProcedure procedure is in conn's current database.
+func checkProcedureExists(ctx context.Context, conn *sql.Conn, name string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `
+SELECT COUNT(*) > 0 FROM information_schema.ROUTINES
+WHERE ROUTINE_SCHEMA = DATABASE() AND ROUTINE_TYPE = 'PROCEDURE' AND ROUTINE_NAME = ?`, name).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,47 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithCheckProcedure(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := testdb.DB(t).ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	db, err := sql.Open("mysql", fmt.Sprintf("root:@tcp(%s)/mysqllocker_test", testdb.Addr(t)))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	procedure := "check_" + fmt.Sprint(rand.Int63())
+	require.NoError(t, InstallCheckProcedure(ctx, db, procedure))
+	// installing again replaces the procedure
+	require.NoError(t, InstallCheckProcedure(ctx, db, procedure))
+
+	h, err := Acquire(ctx, db, lockName, WithCheckProcedure(procedure))
+	require.NoError(t, err)
+	require.NoError(t, h.Touch(ctx))
+	err = h.Conn(func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `DO RELEASE_LOCK(?)`, lockName)
+		return err
+	})
+	require.NoError(t, err)
+	var lostErr *LostError
+	require.True(t, errors.As(h.Touch(ctx), &lostErr))
+
+	// falls back to the usual query when the procedure is missing
+	h, err = Acquire(ctx, db, lockName, WithCheckProcedure("missing_procedure"))
+	require.NoError(t, err)
+	require.NoError(t, h.Touch(ctx))
+}
@@ -0,0 +1,138 @@
+package mysqllocker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrUnknownProfile is returned by Locker.AcquireProfile for a profile that wasn't set with WithProfiles.
+var ErrUnknownProfile = errors.New("unknown lock profile")
+
+// Duration is a time.Duration written in configuration as a string like "30s" or "1m30s".
+type Duration time.Duration
+
+// MarshalText writes d like time.Duration.String.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses d with time.ParseDuration.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes d like time.Duration.String for YAML libraries such as gopkg.in/yaml.v2.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML parses d with time.ParseDuration for YAML libraries such as gopkg.in/yaml.v2.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	err := unmarshal(&text)
+	if err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(text))
+}
+
+// LockProfile is a lock's settings kept in configuration instead of code, so they can be tuned per environment.
+// Unset fields use the Locker's defaults. The yaml tags let a YAML library such as gopkg.in/yaml.v2 decode profiles
+// too.
+type LockProfile struct {
+	// Name is the lock name. It may contain {key} placeholders that are filled in by Locker.AcquireProfile.
+	Name string `json:"name" yaml:"name"`
+	// Namespace replaces the Locker's WithNamespace value for the lock when it is set.
+	Namespace    string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	PingInterval Duration `json:"ping_interval,omitempty" yaml:"ping_interval,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// MaxHold is the WithMaxHold value.
+	MaxHold Duration `json:"max_hold,omitempty" yaml:"max_hold,omitempty"`
+}
+
+// options returns the LockOptions for the profile's settings.
+func (p LockProfile) options() []LockOption {
+	var options []LockOption
+	if p.PingInterval > 0 {
+		options = append(options, WithPingInterval(time.Duration(p.PingInterval)))
+	}
+	if p.Timeout > 0 {
+		options = append(options, WithTimeout(time.Duration(p.Timeout)))
+	}
+	if p.MaxHold > 0 {
+		options = append(options, WithMaxHold(time.Duration(p.MaxHold)))
+	}
+	return options
+}
+
+// lockName returns the profile's name with its placeholders filled in from vars.
+func (p LockProfile) lockName(vars map[string]string) (string, error) {
+	pairs := make([]string, 0, len(vars)*2)
+	for k, v := range vars {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	name := strings.NewReplacer(pairs...).Replace(p.Name)
+	if strings.Contains(name, "{") {
+		return "", fmt.Errorf("lock name %q has placeholders without values", name)
+	}
+	return name, nil
+}
+
+// LoadProfiles reads lock profiles keyed by profile name from JSON such as:
+//
+//	{
+//	  "nightly-report": {"name": "report/{date}", "timeout": "30s", "max_hold": "2h"},
+//	  "cache-refresh": {"name": "cache/refresh", "namespace": "staging", "ping_interval": "5s"}
+//	}
+//
+// Unknown fields are an error so typos in configuration aren't silently ignored.
+func LoadProfiles(r io.Reader) (map[string]LockProfile, error) {
+	var profiles map[string]LockProfile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&profiles)
+	if err != nil {
+		return nil, fmt.Errorf("could not load lock profiles: %w", err)
+	}
+	for name, profile := range profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("could not load lock profiles: profile %q has no name", name)
+		}
+	}
+	return profiles, nil
+}
+
+// WithProfiles sets the profiles used by Locker.AcquireProfile, such as from LoadProfiles.
+func WithProfiles(profiles map[string]LockProfile) LockerOption {
+	return func(l *Locker) {
+		l.profiles = profiles
+	}
+}
+
+// AcquireProfile is like Acquire using the lock name and settings from the profile named profile. vars fill in the
+// placeholders in the profile's lock name. options are applied after the profile's settings, so they take precedence.
+func (l *Locker) AcquireProfile(ctx context.Context, profile string, vars map[string]string, options ...LockOption) (*Handle, error) {
+	p, ok := l.profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, profile)
+	}
+	lockName, err := p.lockName(vars)
+	if err != nil {
+		return nil, err
+	}
+	namespace := l.namespace
+	if p.Namespace != "" {
+		namespace = p.Namespace
+	}
+	return l.acquire(ctx, namespaced(namespace, lockName), l.options(append(p.options(), options...)))
+}
@@ -0,0 +1,85 @@
+package mysqllocker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	profiles, err := LoadProfiles(strings.NewReader(`{
+  "report": {"name": "report/{date}", "timeout": "30s", "max_hold": "2h"},
+  "refresh": {"name": "refresh", "namespace": "staging", "ping_interval": "500ms"}
+}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]LockProfile{
+		"report":  {Name: "report/{date}", Timeout: Duration(30 * time.Second), MaxHold: Duration(2 * time.Hour)},
+		"refresh": {Name: "refresh", Namespace: "staging", PingInterval: Duration(500 * time.Millisecond)},
+	}, profiles)
+
+	_, err = LoadProfiles(strings.NewReader(`{"report": {"name": "report", "timeuot": "30s"}}`))
+	require.Error(t, err)
+	_, err = LoadProfiles(strings.NewReader(`{"report": {"timeout": "30s"}}`))
+	require.Error(t, err)
+	_, err = LoadProfiles(strings.NewReader(`{"report": {"name": "report", "timeout": "soon"}}`))
+	require.Error(t, err)
+}
+
+func TestLockProfileYAML(t *testing.T) {
+	var profiles map[string]LockProfile
+	err := yaml.Unmarshal([]byte(`
+report:
+  name: report/{date}
+  timeout: 30s
+  max_hold: 2h
+`), &profiles)
+	require.NoError(t, err)
+	want := map[string]LockProfile{
+		"report": {Name: "report/{date}", Timeout: Duration(30 * time.Second), MaxHold: Duration(2 * time.Hour)},
+	}
+	require.Equal(t, want, profiles)
+
+	out, err := yaml.Marshal(profiles)
+	require.NoError(t, err)
+	profiles = nil
+	require.NoError(t, yaml.Unmarshal(out, &profiles))
+	require.Equal(t, want, profiles)
+
+	require.Error(t, yaml.Unmarshal([]byte(`report: {name: report, timeout: soon}`), &profiles))
+}
+
+func TestLockerAcquireProfile(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	locker := NewLocker(db,
+		WithNamespace("test"),
+		WithProfiles(map[string]LockProfile{
+			"job":   {Name: lockName + "/{id}", PingInterval: Duration(10 * time.Millisecond)},
+			"other": {Name: lockName, Namespace: "other", MaxHold: Duration(50 * time.Millisecond)},
+		}),
+	)
+	h, err := locker.AcquireProfile(ctx, "job", map[string]string{"id": "1"})
+	require.NoError(t, err)
+	require.Equal(t, "test:"+lockName+"/1", h.Name())
+	require.Equal(t, 10*time.Millisecond, h.opts.pingInterval)
+	require.NoError(t, h.Release())
+
+	h, err = locker.AcquireProfile(ctx, "other", nil)
+	require.NoError(t, err)
+	require.Equal(t, "other:"+lockName, h.Name())
+	<-h.Done()
+	require.True(t, errors.Is(h.Err(), ErrMaxHold))
+
+	_, err = locker.AcquireProfile(ctx, "job", nil)
+	require.Error(t, err)
+	_, err = locker.AcquireProfile(ctx, "missing", nil)
+	require.True(t, errors.Is(err, ErrUnknownProfile))
+}
@@ -0,0 +1,76 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrQuorumLost is sent by LockQuorum when locks held on too many servers are released.
+var ErrQuorumLost = errors.New("lost lock quorum")
+
+// LockQuorum gets lockName on a majority of dbs and holds it until ctx is canceled. Each db should be an
+// independent mysql server. Locks are requested from all servers at once, and locks obtained without reaching a
+// quorum are released before returning an error.
+// Returns an error channel that will receive an error when the lock is released. ErrQuorumLost is sent when so many
+// of the held locks are lost that the remaining ones are no longer a majority.
+func LockQuorum(ctx context.Context, dbs []*sql.DB, lockName string, options ...LockOption) (<-chan error, error) {
+	quorum := len(dbs)/2 + 1
+	holdCtx, cancel := context.WithCancel(ctx)
+	handles := make([]*Handle, len(dbs))
+	var wg sync.WaitGroup
+	for i := range dbs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h, err := Acquire(holdCtx, dbs[i], lockName, options...)
+			if err == nil {
+				handles[i] = h
+			}
+		}(i)
+	}
+	wg.Wait()
+	held := handles[:0]
+	for _, h := range handles {
+		if h != nil {
+			held = append(held, h)
+		}
+	}
+	if len(held) < quorum {
+		cancel()
+		for _, h := range held {
+			<-h.Done()
+		}
+		return nil, fmt.Errorf("could not obtain lock: got %d of %d locks needed for quorum", len(held), quorum)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer cancel()
+		released := make(chan *Handle, len(held))
+		for _, h := range held {
+			go func(h *Handle) {
+				<-h.Done()
+				released <- h
+			}(h)
+		}
+		var err error
+		remaining := len(held)
+		for remaining > 0 {
+			h := <-released
+			remaining--
+			if err == nil {
+				err = h.Err()
+			}
+			if remaining < quorum && holdCtx.Err() == nil {
+				err = ErrQuorumLost
+				cancel()
+			}
+		}
+		errs <- err
+	}()
+	return errs, nil
+}
@@ -0,0 +1,27 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestLockQuorum(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs, err := LockQuorum(ctx, []*sql.DB{db}, lockName)
+	require.NoError(t, err)
+
+	otherErrs, err := LockQuorum(ctx, []*sql.DB{db, db, db}, lockName)
+	require.Error(t, err)
+	require.Nil(t, otherErrs)
+
+	cancel()
+	require.NoError(t, <-errs)
+}
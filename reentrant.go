@@ -0,0 +1,143 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// WithReentrant lets a lock be acquired again while this process already holds it. The lock is shared between the
+// holders through a single session and is released when the last holder releases it.
+// Locks are shared between acquisitions that use the same *sql.DB and lock name and both use WithReentrant. Options
+// that affect holding the lock, such as WithPingInterval, come from the first acquisition.
+func WithReentrant() LockOption {
+	return func(o *lockOpts) {
+		o.reentrant = true
+	}
+}
+
+type reentrantKey struct {
+	db       *sql.DB
+	lockName string
+}
+
+type reentrantLock struct {
+	// ready is closed when handle is set or the acquisition failed
+	ready  chan struct{}
+	handle *Handle
+	refs   int
+}
+
+var (
+	reentrantMux   sync.Mutex
+	reentrantLocks = map[reentrantKey]*reentrantLock{}
+)
+
+// acquireReentrant returns a Handle sharing the process's existing hold on lockName or acquires a new one.
+// The returned Handle is released when holdCtx is canceled.
+func acquireReentrant(ctx, holdCtx context.Context, db *sql.DB, lockName string, opts *lockOpts) (*Handle, error) {
+	key := reentrantKey{db: db, lockName: lockName}
+	for {
+		reentrantMux.Lock()
+		rl := reentrantLocks[key]
+		if rl == nil {
+			break
+		}
+		reentrantMux.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("could not obtain lock: %w", ctx.Err())
+		case <-rl.ready:
+		}
+		reentrantMux.Lock()
+		if reentrantLocks[key] == rl && rl.handle != nil {
+			select {
+			case <-rl.handle.Done():
+				// the shared lock was lost, so the next holder needs a new one
+				delete(reentrantLocks, key)
+			default:
+				rl.refs++
+				reentrantMux.Unlock()
+				return newReentrantHandle(holdCtx, key, rl, opts), nil
+			}
+		}
+		reentrantMux.Unlock()
+	}
+
+	// this is the first holder. The lock is held with its own context so it can outlive this caller.
+	rl := &reentrantLock{
+		ready: make(chan struct{}),
+	}
+	reentrantLocks[key] = rl
+	reentrantMux.Unlock()
+
+	// holders each get their own error handler calls, so the shared lock doesn't need one
+	sharedOpts := *opts
+	sharedOpts.errorHandler = nil
+	h, err := acquire(ctx, db, lockName, &sharedOpts)
+	reentrantMux.Lock()
+	defer reentrantMux.Unlock()
+	defer close(rl.ready)
+	if err != nil {
+		delete(reentrantLocks, key)
+		return nil, err
+	}
+	h.start(context.Background())
+	rl.handle = h
+	rl.refs = 1
+	return newReentrantHandle(holdCtx, key, rl, opts), nil
+}
+
+// newReentrantHandle returns a Handle for one holder of rl that is released when ctx is canceled.
+func newReentrantHandle(ctx context.Context, key reentrantKey, rl *reentrantLock, opts *lockOpts) *Handle {
+	shared := rl.handle
+	h := &Handle{
+		lockName: shared.lockName,
+		db:       shared.db,
+		opts:     opts,
+		conn:     shared.conn,
+		token:    shared.token,
+		connMux:  shared.connMux,
+		stmts:    shared.stmts,
+		done:     make(chan struct{}),
+		// report the shared lock's acquisition
+		acquiredAt:  shared.acquiredAt,
+		epoch:       shared.epoch,
+		lastRenewal: shared.lastRenewal,
+		uncertain:   shared.uncertain,
+		state:       shared.state,
+		subs:        shared.subs,
+		shared:      shared,
+	}
+	ctx, h.cancel = context.WithCancel(ctx)
+	go func() {
+		var err error
+		lost := false
+		select {
+		case <-shared.Done():
+			err, lost = shared.Err(), shared.lost()
+		case <-ctx.Done():
+			err = ignoreErr(context.Cause(ctx))
+		}
+		reentrantMux.Lock()
+		rl.refs--
+		last := rl.refs == 0
+		if last && reentrantLocks[key] == rl {
+			delete(reentrantLocks, key)
+		}
+		reentrantMux.Unlock()
+		if last {
+			shared.cancel()
+			<-shared.Done()
+			if err == nil {
+				err, lost = shared.Err(), shared.lost()
+			}
+		}
+		h.connMux.Lock()
+		h.released = true
+		h.connMux.Unlock()
+		h.finish(err, lost)
+	}()
+	return h
+}
@@ -0,0 +1,49 @@
+package mysqllocker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWithReentrant(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	h1, err := Acquire(ctx1, db, lockName, WithReentrant())
+	require.NoError(t, err)
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	h2, err := Acquire(ctx2, db, lockName, WithReentrant())
+	require.NoError(t, err)
+
+	// both handles share a session
+	require.Same(t, h1.conn, h2.conn)
+
+	// without WithReentrant, the lock is unavailable
+	_, err = Acquire(ctx1, db, lockName)
+	require.Error(t, err)
+
+	cancel1()
+	<-h1.Done()
+	require.NoError(t, h1.Err())
+	owner, err := GetLockOwner(ctx2, db, lockName)
+	require.NoError(t, err)
+	require.NotNil(t, owner, "lock should be held until the last holder releases it")
+	var lostErr *LostError
+	require.True(t, errors.As(h1.SetData(ctx2, "stale"), &lostErr), "a released holder shouldn't use the shared session")
+
+	cancel2()
+	<-h2.Done()
+	require.NoError(t, h2.Err())
+	owner, err = GetLockOwner(context.Background(), db, lockName)
+	require.NoError(t, err)
+	require.Nil(t, owner)
+	require.True(t, errors.As(h2.SetData(context.Background(), "stale"), &lostErr))
+	require.True(t, errors.As(h2.Touch(context.Background()), &lostErr))
+}
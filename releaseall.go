@@ -0,0 +1,54 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errNoSuchFunction is ER_SP_DOES_NOT_EXIST, which servers before 5.7 return for RELEASE_ALL_LOCKS().
+const errNoSuchFunction = 1305
+
+// ReleaseAll is like Release except that it releases every named lock the lock's session holds, including any
+// taken with GET_LOCK() through Conn or Tx, with RELEASE_ALL_LOCKS(). Without it, those locks stay with the session
+// when its connection goes back to the pool. Servers before 5.7 don't have RELEASE_ALL_LOCKS(), so only the Handle's
+// own lock is released on them.
+//
+// For WithReentrant locks, the session's locks are released when the last holder releases the lock.
+func (h *Handle) ReleaseAll() error {
+	h.connMux.Lock()
+	if !h.isReleased() {
+		h.stmts.releaseAll = true
+	}
+	h.connMux.Unlock()
+	return h.Release()
+}
+
+// WithReleaseAll makes the lock's release always work like Handle.ReleaseAll, so locks taken through Conn or Tx on
+// the lock's session are released with it however the lock ends.
+func WithReleaseAll() LockOption {
+	return func(o *lockOpts) {
+		o.releaseAll = true
+	}
+}
+
+// releaseAllLocks releases every named lock held by conn's session with one statement. names are the locks known
+// to be held, which are released one at a time on servers without RELEASE_ALL_LOCKS().
+func releaseAllLocks(ctx context.Context, conn *sql.Conn, names []string, opts *lockOpts) error {
+	_, err := conn.ExecContext(ctx, opts.commented(ctx, names[0], `DO RELEASE_ALL_LOCKS()`))
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != errNoSuchFunction {
+		return err
+	}
+	calls := make([]string, len(names))
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		calls[i] = "RELEASE_LOCK(?)"
+		args[i] = name
+	}
+	_, err = conn.ExecContext(ctx, opts.commented(ctx, names[0], "DO "+strings.Join(calls, ", ")), args...)
+	return err
+}
@@ -0,0 +1,62 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DefaultTableOptions are the usual table options, engine and charset, to put after CREATE TABLE.
+const DefaultTableOptions = "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+// SchemaSQL returns the CREATE TABLE statements for the audit table, the SetData table and the preemption table, named
+// by the WithAudit, WithDataTable and WithPreemptionTable options or DefaultAuditTable, DefaultDataTable and
+// DefaultPreemptionTable, with tableOptions, such as DefaultTableOptions, after each. It is for teams that manage DDL
+// through their own migrations instead of EnsureSchema.
+func SchemaSQL(tableOptions string, options ...LockOption) []string {
+	opts := newLockOpts(options)
+	auditTable := opts.auditTable
+	if auditTable == "" {
+		auditTable = DefaultAuditTable
+	}
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  lock_name VARCHAR(64) NOT NULL,
+  event VARCHAR(16) NOT NULL,
+  holder VARCHAR(255) NOT NULL,
+  connection_id BIGINT UNSIGNED NOT NULL,
+  error TEXT NULL,
+  created_at DATETIME(6) NOT NULL,
+  KEY lock_name_created_at (lock_name, created_at)
+) %s`, auditTable, tableOptions),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  lock_name VARCHAR(64) NOT NULL PRIMARY KEY,
+  data JSON NOT NULL,
+  holder VARCHAR(255) NOT NULL,
+  connection_id BIGINT UNSIGNED NOT NULL,
+  updated_at DATETIME(6) NOT NULL
+) %s`, opts.dataTableName(), tableOptions),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  lock_name VARCHAR(64) NOT NULL,
+  request_id VARCHAR(64) NOT NULL,
+  requester VARCHAR(255) NOT NULL,
+  priority INT NOT NULL,
+  requested_at DATETIME(6) NOT NULL,
+  expires_at DATETIME(6) NOT NULL,
+  PRIMARY KEY (lock_name, request_id)
+) %s`, opts.preemptTableName(), tableOptions),
+	}
+}
+
+// EnsureSchema runs the statements from SchemaSQL with tableOptions, such as DefaultTableOptions. Tables that already
+// exist are left as they are. Pass it the same WithAudit, WithDataTable and WithPreemptionTable options as Acquire.
+func EnsureSchema(ctx context.Context, db *sql.DB, tableOptions string, options ...LockOption) error {
+	for _, stmt := range SchemaSQL(tableOptions, options...) {
+		_, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
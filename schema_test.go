@@ -0,0 +1,22 @@
+package mysqllocker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaSQL(t *testing.T) {
+	stmts := SchemaSQL(DefaultTableOptions)
+	require.Len(t, stmts, 3)
+	require.True(t, strings.HasPrefix(stmts[0], "CREATE TABLE IF NOT EXISTS mysqllocker_audit ("))
+	require.True(t, strings.HasPrefix(stmts[1], "CREATE TABLE IF NOT EXISTS mysqllocker_data ("))
+	require.True(t, strings.HasPrefix(stmts[2], "CREATE TABLE IF NOT EXISTS mysqllocker_preemptions ("))
+	require.True(t, strings.HasSuffix(stmts[1], ") "+DefaultTableOptions))
+
+	stmts = SchemaSQL("ENGINE=MyISAM", WithAudit("db.audit"), WithDataTable("db.data"))
+	require.True(t, strings.HasPrefix(stmts[0], "CREATE TABLE IF NOT EXISTS db.audit ("))
+	require.True(t, strings.HasPrefix(stmts[1], "CREATE TABLE IF NOT EXISTS db.data ("))
+	require.True(t, strings.HasSuffix(stmts[0], ") ENGINE=MyISAM"))
+}
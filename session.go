@@ -0,0 +1,75 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// WithSessionTimeouts raises the wait_timeout and net_read_timeout session variables on the lock's connection to at
+// least waitTimeout and netReadTimeout, so an aggressive server-wide idle timeout can't end the lock's session
+// between checks. A zero duration leaves that variable alone, and values already higher are kept. The previous
+// values are restored when the lock is released, before the connection goes back to db's pool.
+func WithSessionTimeouts(waitTimeout, netReadTimeout time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.sessionWaitTimeout = waitTimeout
+		o.sessionNetReadTimeout = netReadTimeout
+	}
+}
+
+// configureSession applies WithSessionTimeouts to conn and fits the ping interval to the session's wait_timeout.
+// When WithPingInterval wasn't used, the ping interval is lowered to a third of wait_timeout if that is shorter than
+// the default. An explicit ping interval that isn't shorter than wait_timeout is an error because the server would
+// end the session between checks. It returns a statement that restores the previous timeouts, or "" when nothing
+// was changed.
+func configureSession(ctx context.Context, conn *sql.Conn, opts *lockOpts) (string, error) {
+	var waitTimeout, netReadTimeout int64
+	row := conn.QueryRowContext(ctx, `SELECT @@SESSION.wait_timeout, @@SESSION.net_read_timeout`)
+	err := row.Scan(&waitTimeout, &netReadTimeout)
+	if err != nil {
+		return "", err
+	}
+	var set, restore []string
+	if seconds := durationSeconds(opts.sessionWaitTimeout); seconds > waitTimeout {
+		set = append(set, fmt.Sprintf("wait_timeout = %d", seconds))
+		restore = append(restore, fmt.Sprintf("wait_timeout = %d", waitTimeout))
+	}
+	if seconds := durationSeconds(opts.sessionNetReadTimeout); seconds > netReadTimeout {
+		set = append(set, fmt.Sprintf("net_read_timeout = %d", seconds))
+		restore = append(restore, fmt.Sprintf("net_read_timeout = %d", netReadTimeout))
+	}
+	if len(set) == 0 {
+		return "", fitPingInterval(opts, waitTimeout)
+	}
+	_, err = conn.ExecContext(ctx, "SET SESSION "+strings.Join(set, ", "))
+	if err != nil {
+		return "", err
+	}
+	if seconds := durationSeconds(opts.sessionWaitTimeout); seconds > waitTimeout {
+		waitTimeout = seconds
+	}
+	return "SET SESSION " + strings.Join(restore, ", "), fitPingInterval(opts, waitTimeout)
+}
+
+// fitPingInterval fits opts.pingInterval to a wait_timeout of waitTimeout seconds.
+func fitPingInterval(opts *lockOpts, waitTimeout int64) error {
+	limit := time.Duration(waitTimeout) * time.Second
+	if opts.pingIntervalSet {
+		if opts.pingInterval >= limit {
+			return fmt.Errorf("ping interval %v is not shorter than the session's wait_timeout of %v", opts.pingInterval, limit)
+		}
+		return nil
+	}
+	if limit/3 < opts.pingInterval {
+		opts.pingInterval = limit / 3
+	}
+	return nil
+}
+
+// durationSeconds returns d in whole seconds, rounded up.
+func durationSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,23 @@
+package mysqllocker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFitPingInterval(t *testing.T) {
+	opts := newLockOpts(nil)
+	require.NoError(t, fitPingInterval(opts, 28800))
+	require.Equal(t, defaultPingInterval, opts.pingInterval)
+
+	opts = newLockOpts(nil)
+	require.NoError(t, fitPingInterval(opts, 15))
+	require.Equal(t, 5*time.Second, opts.pingInterval)
+
+	opts = newLockOpts([]LockOption{WithPingInterval(time.Minute)})
+	require.NoError(t, fitPingInterval(opts, 120))
+	require.Equal(t, time.Minute, opts.pingInterval)
+	require.Error(t, fitPingInterval(opts, 60))
+}
@@ -0,0 +1,47 @@
+package mysqllocker
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithRenewalSLO watches how long each regular check of the lock takes. A check slower than warn sends an
+// EventSlowRenewal. A check slower than uncertain sends an EventUncertain instead and makes Handle.Uncertain return
+// true until a later check is faster, so callers can pause risky work while the database is slow to answer. A zero
+// threshold is not checked. A useful warn threshold is half the ping interval.
+func WithRenewalSLO(warn, uncertain time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.slowRenewal = warn
+		o.uncertainRenewal = uncertain
+	}
+}
+
+// Uncertain returns whether the last check of the lock was slower than the uncertain threshold from WithRenewalSLO.
+// The lock may still be held, but it is safer to pause work that would be harmful if it weren't.
+func (h *Handle) Uncertain() bool {
+	return atomic.LoadInt32(h.uncertain) == 1
+}
+
+// checkLatency compares a successful check's round trip with the WithRenewalSLO thresholds.
+func (h *Handle) checkLatency(latency time.Duration) {
+	if h.opts.uncertainRenewal > 0 && latency > h.opts.uncertainRenewal {
+		atomic.StoreInt32(h.uncertain, 1)
+		h.publishOnConn(Event{Type: EventUncertain, Latency: latency})
+		return
+	}
+	atomic.StoreInt32(h.uncertain, 0)
+	if h.opts.slowRenewal > 0 && latency > h.opts.slowRenewal {
+		h.publishOnConn(Event{Type: EventSlowRenewal, Latency: latency})
+	}
+}
+
+// publishOnConn publishes an event for the held lock, auditing it on the lock's connection so it doesn't need a
+// second connection from the pool.
+func (h *Handle) publishOnConn(event Event) {
+	h.connMux.Lock()
+	defer h.connMux.Unlock()
+	if h.released {
+		return
+	}
+	h.publish(h.conn, event)
+}
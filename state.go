@@ -0,0 +1,75 @@
+package mysqllocker
+
+import (
+	"sync"
+	"time"
+)
+
+// LockState is where a Handle is in its lock's life, as reported by Handle.State.
+type LockState int
+
+const (
+	// StateHeld is while the lock is held and its last check succeeded.
+	StateHeld LockState = iota + 1
+	// StateRenewing is after a failed check of the lock until one succeeds.
+	StateRenewing
+	// StateLost is after the lock was released because of an error. Handle.Err returns the error.
+	StateLost
+	// StateReleased is after the lock was released without an error.
+	StateReleased
+)
+
+func (s LockState) String() string {
+	switch s {
+	case StateHeld:
+		return "held"
+	case StateRenewing:
+		return "renewing"
+	case StateLost:
+		return "lost"
+	case StateReleased:
+		return "released"
+	default:
+		return "unknown"
+	}
+}
+
+// lockState is a LockState and when it was entered.
+type lockState struct {
+	mux   sync.Mutex
+	state LockState
+	since time.Time
+}
+
+func newLockState(state LockState, since time.Time) *lockState {
+	return &lockState{
+		state: state,
+		since: since,
+	}
+}
+
+// set moves to state unless it is already the current state.
+func (s *lockState) set(state LockState) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.state != state {
+		s.state = state
+		s.since = time.Now()
+	}
+}
+
+func (s *lockState) get() (LockState, time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.state, s.since
+}
+
+// State returns the Handle's current state and when it entered it, so health endpoints and supervisors can report
+// on the lock without watching its events.
+func (h *Handle) State() (state LockState, since time.Time) {
+	state, since = h.ended.get()
+	if state != 0 {
+		return state, since
+	}
+	return h.state.get()
+}
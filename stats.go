@@ -0,0 +1,109 @@
+package mysqllocker
+
+import "sync/atomic"
+
+// LockStats are counts for one lock name from a Locker, kept since the Locker was created.
+type LockStats struct {
+	// Attempts is how many times getting the lock was attempted, counting each WithRetry retry.
+	Attempts int64
+	// Contended is how many attempts failed because another session held the lock, including timeouts waiting for
+	// it and WithContestedWindow fast failures.
+	Contended int64
+	// Renewals is how many regular checks found the lock still held.
+	Renewals int64
+	// Losses is how many times the lock ended with an error instead of being released.
+	Losses int64
+}
+
+// lockCounters are the atomic counters behind LockStats. A nil *lockCounters counts nothing.
+type lockCounters struct {
+	attempts  int64
+	contended int64
+	renewals  int64
+	losses    int64
+}
+
+func (c *lockCounters) attempt() {
+	if c != nil {
+		atomic.AddInt64(&c.attempts, 1)
+	}
+}
+
+func (c *lockCounters) contend() {
+	if c != nil {
+		atomic.AddInt64(&c.contended, 1)
+	}
+}
+
+func (c *lockCounters) renew() {
+	if c != nil {
+		atomic.AddInt64(&c.renewals, 1)
+	}
+}
+
+func (c *lockCounters) lose() {
+	if c != nil {
+		atomic.AddInt64(&c.losses, 1)
+	}
+}
+
+// countersFor returns the counters for lockName, or nil when the lock isn't from a Locker.
+func (o *lockOpts) countersFor(lockName string) *lockCounters {
+	if o.counters == nil {
+		return nil
+	}
+	return o.counters(lockName)
+}
+
+// maxStatsNames is how many lock names a Locker keeps counts for before it drops the counts of names it doesn't hold.
+const maxStatsNames = 10000
+
+// Stats returns the Locker's counts for lockName. Counts are kept for every name the Locker has tried to lock, except
+// that once more than 10,000 names have counts, the counts for names the Locker doesn't hold are dropped.
+func (l *Locker) Stats(lockName string) LockStats {
+	l.statsMux.Lock()
+	c := l.stats[l.name(lockName)]
+	l.statsMux.Unlock()
+	if c == nil {
+		return LockStats{}
+	}
+	return LockStats{
+		Attempts:  atomic.LoadInt64(&c.attempts),
+		Contended: atomic.LoadInt64(&c.contended),
+		Renewals:  atomic.LoadInt64(&c.renewals),
+		Losses:    atomic.LoadInt64(&c.losses),
+	}
+}
+
+// counters returns the counters for the namespaced lockName, creating them if needed.
+func (l *Locker) counters(lockName string) *lockCounters {
+	l.statsMux.Lock()
+	defer l.statsMux.Unlock()
+	if l.stats == nil {
+		l.stats = map[string]*lockCounters{}
+	}
+	c := l.stats[lockName]
+	if c == nil {
+		if len(l.stats) >= maxStatsNames {
+			l.pruneStats()
+		}
+		c = &lockCounters{}
+		l.stats[lockName] = c
+	}
+	return c
+}
+
+// pruneStats drops the counters for names the Locker doesn't hold. The caller must hold statsMux.
+func (l *Locker) pruneStats() {
+	l.heldMux.Lock()
+	held := make(map[string]bool, len(l.held))
+	for h := range l.held {
+		held[h.lockName] = true
+	}
+	l.heldMux.Unlock()
+	for name := range l.stats {
+		if !held[name] {
+			delete(l.stats, name)
+		}
+	}
+}
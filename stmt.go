@@ -0,0 +1,66 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const (
+	checkQuery   = `SELECT CONNECTION_ID(), IS_USED_LOCK(?), @mysqllocker_token`
+	releaseQuery = `DO RELEASE_LOCK(?)`
+)
+
+// lockStmts are the statements a Handle runs on every check and on release. They are prepared once per connection
+// on the first full check and reused, so the server doesn't parse the same query on every tick. A lock's
+// WithQueryComments comment and whether the WithCheckProcedure procedure is used are fixed when the statements are
+// prepared.
+type lockStmts struct {
+	check   *sql.Stmt
+	release *sql.Stmt
+	// restoreSession undoes WithSessionTimeouts when the lock is released
+	restoreSession string
+	// releaseAll is set by Handle.ReleaseAll to release all of the session's locks instead of just the Handle's
+	releaseAll bool
+}
+
+// prepare prepares the statements on conn if they aren't already. The caller must hold the Handle's connMux.
+func (s *lockStmts) prepare(ctx context.Context, conn *sql.Conn, lockName string, opts *lockOpts) error {
+	if s.check != nil {
+		return nil
+	}
+	query := checkQuery
+	if opts.checkProcedure != "" {
+		exists, err := checkProcedureExists(ctx, conn, opts.checkProcedure)
+		if err != nil {
+			return err
+		}
+		if exists {
+			query = fmt.Sprintf(`CALL %s(?)`, opts.checkProcedure)
+		}
+	}
+	check, err := conn.PrepareContext(ctx, opts.commented(ctx, lockName, query))
+	if err != nil {
+		return err
+	}
+	release, err := conn.PrepareContext(ctx, opts.commented(ctx, lockName, releaseQuery))
+	if err != nil {
+		_ = check.Close() //nolint:errcheck
+		return err
+	}
+	s.check, s.release = check, release
+	return nil
+}
+
+// close closes any prepared statements. It is safe to call on a nil *lockStmts.
+func (s *lockStmts) close() {
+	if s == nil {
+		return
+	}
+	for _, stmt := range []*sql.Stmt{s.check, s.release} {
+		if stmt != nil {
+			_ = stmt.Close() //nolint:errcheck
+		}
+	}
+	s.check, s.release = nil, nil
+}
@@ -0,0 +1,36 @@
+package mysqllocker
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// PprofLabel is the pprof label set to the lock name on the goroutines holding locks, so CPU and goroutine profiles
+// attribute them to their locks. For a Group, the label is the group's names joined with commas.
+const PprofLabel = "mysqllocker_lock"
+
+// Execution traces from runtime/trace show time spent waiting for a lock as a "mysqllocker.wait" region and time
+// holding it as a "mysqllocker.hold" region on the holding goroutine. Each region starts with a "mysqllocker.lock"
+// log message of the lock name.
+const (
+	traceWaitRegion = "mysqllocker.wait"
+	traceHoldRegion = "mysqllocker.hold"
+	traceLockKey    = "mysqllocker.lock"
+)
+
+// traceWait starts the trace region for waiting for lockName. The caller must end it on the same goroutine.
+func traceWait(ctx context.Context, lockName string) *trace.Region {
+	region := trace.StartRegion(ctx, traceWaitRegion)
+	trace.Log(ctx, traceLockKey, lockName)
+	return region
+}
+
+// goHold calls hold in a new goroutine that is labeled with label for pprof and traced as a hold region.
+func goHold(ctx context.Context, label string, hold func(ctx context.Context)) {
+	go pprof.Do(ctx, pprof.Labels(PprofLabel, label), func(ctx context.Context) {
+		defer trace.StartRegion(ctx, traceHoldRegion).End()
+		trace.Log(ctx, traceLockKey, label)
+		hold(ctx)
+	})
+}
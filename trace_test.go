@@ -0,0 +1,24 @@
+package mysqllocker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestPprofLabel(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	h, err := Acquire(context.Background(), db, lockName)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 1))
+	require.Contains(t, buf.String(), fmt.Sprintf(`"%s":"%s"`, PprofLabel, lockName))
+	require.NoError(t, h.Release())
+}
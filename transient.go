@@ -0,0 +1,50 @@
+package mysqllocker
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TransientErrorNumbers are the mysql server error numbers IsTransient treats as transient, with descriptions.
+// Callers may add to it before getting locks.
+var TransientErrorNumbers = map[uint16]string{
+	1205: "lock wait timeout exceeded",
+	1213: "deadlock found when trying to get lock",
+	3058: "deadlock found when trying to get user-level lock",
+}
+
+// IsTransient returns whether err is likely to go away when the operation is retried: a mysql error in
+// TransientErrorNumbers, a *GetLockError, a bad or invalid connection, or a network timeout.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		_, ok := TransientErrorNumbers[mysqlErr.Number]
+		return ok
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var getLockErr *GetLockError
+	if errors.As(err, &getLockErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// WithRetry retries getting the lock up to retries more times, waiting backoff between attempts, when an attempt
+// fails with an error that IsTransient reports as transient. Attempts that find the lock held by another session
+// aren't retried. Use WithTimeout to wait for those.
+func WithRetry(retries int, backoff time.Duration) LockOption {
+	return func(o *lockOpts) {
+		o.retries = retries
+		o.retryBackoff = backoff
+	}
+}
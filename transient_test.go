@@ -0,0 +1,53 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransient(t *testing.T) {
+	require.False(t, IsTransient(nil))
+	require.False(t, IsTransient(errors.New("nope")))
+	require.True(t, IsTransient(driver.ErrBadConn))
+	require.True(t, IsTransient(fmt.Errorf("wrapped: %w", mysql.ErrInvalidConn)))
+	require.True(t, IsTransient(&mysql.MySQLError{Number: 1213}))
+	require.True(t, IsTransient(fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1205})))
+	require.False(t, IsTransient(&mysql.MySQLError{Number: 1064}))
+	require.True(t, IsTransient(timeoutError{}))
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	failures := 2
+	faults := WithFaults(func(point FaultPoint) error {
+		if point == FaultAcquire && failures > 0 {
+			failures--
+			return &mysql.MySQLError{Number: 1213, Message: "injected deadlock"}
+		}
+		return nil
+	})
+	_, err := Acquire(ctx, db, lockName, faults, WithRetry(1, 0))
+	require.True(t, IsTransient(err))
+	require.Zero(t, failures)
+
+	failures = 2
+	h, err := Acquire(ctx, db, lockName, faults, WithRetry(2, 0))
+	require.NoError(t, err)
+	require.NoError(t, h.Release())
+}
@@ -0,0 +1,121 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const weightedRetryInterval = 100 * time.Millisecond
+
+// Weighted is a cluster-wide weighted semaphore modeled on golang.org/x/sync/semaphore. Its size is made of units
+// that are each a named lock, "NAME/0" through "NAME/SIZE-1", so every process using the same name and size shares
+// the same units. Each held unit uses a connection from db.
+//
+// Unlike the x/sync semaphore, waiters aren't served in order, and a waiter for many units can be starved by waiters
+// for fewer.
+type Weighted struct {
+	db      *sql.DB
+	name    string
+	size    int64
+	options []LockOption
+	mux     sync.Mutex
+	held    map[int64]*Handle
+}
+
+// NewWeighted returns a Weighted with size units named after name. options are used for every unit's lock, except
+// that units are always tried without waiting.
+func NewWeighted(db *sql.DB, name string, size int64, options ...LockOption) *Weighted {
+	return &Weighted{
+		db:      db,
+		name:    name,
+		size:    size,
+		options: append(options[:len(options):len(options)], WithNoWait()),
+		held:    map[int64]*Handle{},
+	}
+}
+
+// unitName returns the lock name for unit i.
+func (w *Weighted) unitName(i int64) string {
+	return shortenLockName(fmt.Sprintf("%s%s%d", w.name, lockNameSeparator, i))
+}
+
+// Acquire gets n units, blocking until they are available or ctx is done. On failure, it returns ctx.Err() or the
+// error from trying a unit, and holds no additional units.
+func (w *Weighted) Acquire(ctx context.Context, n int64) error {
+	for {
+		ok, err := w.TryAcquire(ctx, n)
+		if err != nil || ok {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(weightedRetryInterval):
+		}
+	}
+}
+
+// TryAcquire gets n units without blocking. It returns false and holds no additional units when fewer than n are
+// free. Units held by other sessions are skipped, but any other error from trying a unit is returned.
+func (w *Weighted) TryAcquire(ctx context.Context, n int64) (bool, error) {
+	if n > w.size {
+		return false, fmt.Errorf("could not obtain lock: %d units requested from a semaphore of size %d", n, w.size)
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	var got []int64
+	for i := int64(0); i < w.size && int64(len(got)) < n; i++ {
+		if _, ok := w.held[i]; ok {
+			continue
+		}
+		h, err := AcquireDetached(ctx, w.db, w.unitName(i), w.options...)
+		if err != nil {
+			var timeoutErr *TimeoutError
+			if ctx.Err() == nil && errors.As(err, &timeoutErr) {
+				continue
+			}
+			w.releaseUnits(got)
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			return false, err
+		}
+		w.held[i] = h
+		got = append(got, i)
+	}
+	if int64(len(got)) < n {
+		w.releaseUnits(got)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Release releases n of the units held by w. Like the x/sync semaphore, it panics when releasing more units than
+// are held.
+func (w *Weighted) Release(n int64) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if n > int64(len(w.held)) {
+		panic("mysqllocker: released more units than held")
+	}
+	units := make([]int64, 0, n)
+	for i := range w.held {
+		if int64(len(units)) == n {
+			break
+		}
+		units = append(units, i)
+	}
+	w.releaseUnits(units)
+}
+
+// releaseUnits releases units. The caller must hold mux.
+func (w *Weighted) releaseUnits(units []int64) {
+	for _, i := range units {
+		_ = w.held[i].Release() //nolint:errcheck
+		delete(w.held, i)
+	}
+}
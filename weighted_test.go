@@ -0,0 +1,56 @@
+package mysqllocker
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestWeighted(t *testing.T) {
+	t.Parallel()
+	lockName := t.Name()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	w1 := NewWeighted(db, lockName, 3)
+	w2 := NewWeighted(db, lockName, 3)
+	defer func() {
+		w1.Release(int64(len(w1.held)))
+		w2.Release(int64(len(w2.held)))
+	}()
+
+	_, err := w1.TryAcquire(ctx, 4)
+	require.Error(t, err)
+	require.NoError(t, w1.Acquire(ctx, 2))
+	ok, err := w2.TryAcquire(ctx, 2)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = w2.TryAcquire(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, w2.Acquire(waitCtx, 1))
+
+	w1.Release(1)
+	require.NoError(t, w2.Acquire(ctx, 1))
+	require.Panics(t, func() {
+		w1.Release(2)
+	})
+}
+
+func TestWeightedError(t *testing.T) {
+	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:1)/")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	w := NewWeighted(db, t.Name(), 3)
+	ok, err := w.TryAcquire(context.Background(), 1)
+	require.Error(t, err)
+	require.False(t, ok)
+	require.Empty(t, w.held)
+	require.Error(t, w.Acquire(context.Background(), 1))
+}
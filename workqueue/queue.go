@@ -0,0 +1,207 @@
+// Package workqueue is a table-backed work queue where workers claim items with a mysqllocker lock per item.
+// A claim is held by the claiming session, so the item goes back to the queue on its own when the worker's session
+// ends, including when the worker crashes.
+package workqueue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/willabides/mysqllocker"
+)
+
+// ErrEmpty is returned by Claim when every unfinished item is already claimed.
+var ErrEmpty = errors.New("no unclaimed items")
+
+const defaultBatchSize = 100
+
+// Queue is a work queue stored in a table. The table must already exist, such as from EnsureSchema, with at least
+// these columns:
+//
+//	CREATE TABLE work_queue (
+//	  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//	  payload BLOB NOT NULL,
+//	  created_at DATETIME(6) NOT NULL,
+//	  done_at DATETIME(6) NULL,
+//	  KEY done_at_id (done_at, id)
+//	)
+type Queue struct {
+	db          *sql.DB
+	table       string
+	batchSize   int
+	lockOptions []mysqllocker.LockOption
+}
+
+// Option is an optional value for New
+type Option func(*Queue)
+
+// WithBatchSize sets how many candidate items Claim reads at a time. Default is 100.
+func WithBatchSize(n int) Option {
+	return func(q *Queue) {
+		q.batchSize = n
+	}
+}
+
+// WithLockOptions sets options for the item locks, such as mysqllocker.WithPingInterval to control how often
+// claims are renewed.
+func WithLockOptions(options ...mysqllocker.LockOption) Option {
+	return func(q *Queue) {
+		q.lockOptions = append(q.lockOptions, options...)
+	}
+}
+
+// New returns a Queue for table. table is used in queries as-is, so it may be qualified with a database name.
+func New(db *sql.DB, table string, options ...Option) *Queue {
+	q := &Queue{
+		db:        db,
+		table:     table,
+		batchSize: defaultBatchSize,
+	}
+	for _, o := range options {
+		o(q)
+	}
+	return q
+}
+
+// LockName returns the name of the lock that claims the item with id.
+func (q *Queue) LockName(id int64) string {
+	return mysqllocker.Name("workqueue", q.table, strconv.FormatInt(id, 10)).String()
+}
+
+// Add adds an item to the queue and returns its id.
+func (q *Queue) Add(ctx context.Context, payload []byte) (int64, error) {
+	query := fmt.Sprintf(`INSERT INTO %s (payload, created_at) VALUES (?, NOW(6))`, q.table)
+	res, err := q.db.ExecContext(ctx, query, payload)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Claim claims the oldest unfinished item that no other worker has claimed. The claim lasts until Item.Complete or
+// Item.Release is called, ctx is canceled or the claim is lost. It returns ErrEmpty when there is nothing to claim.
+func (q *Queue) Claim(ctx context.Context) (*Item, error) {
+	var lastID int64
+	for {
+		ids, err := q.candidates(ctx, lastID)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, ErrEmpty
+		}
+		for _, id := range ids {
+			item, err := q.claim(ctx, id)
+			if err != nil || item != nil {
+				return item, err
+			}
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// candidates returns the ids of up to batchSize unfinished items after afterID.
+func (q *Queue) candidates(ctx context.Context, afterID int64) ([]int64, error) {
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE done_at IS NULL AND id > ? ORDER BY id LIMIT ?`, q.table)
+	rows, err := q.db.QueryContext(ctx, query, afterID, q.batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// claim tries to claim the item with id. It returns nil without an error when another worker has the item or it
+// was finished since candidates ran.
+func (q *Queue) claim(ctx context.Context, id int64) (*Item, error) {
+	lockOptions := append(q.lockOptions[:len(q.lockOptions):len(q.lockOptions)], mysqllocker.WithNoWait())
+	h, err := mysqllocker.Acquire(ctx, q.db, q.LockName(id), lockOptions...)
+	if err != nil {
+		var timeoutErr *mysqllocker.TimeoutError
+		if ctx.Err() == nil && errors.As(err, &timeoutErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	item := &Item{
+		ID:     id,
+		q:      q,
+		handle: h,
+	}
+	query := fmt.Sprintf(`SELECT payload FROM %s WHERE id = ? AND done_at IS NULL`, q.table)
+	err = q.db.QueryRowContext(ctx, query, id).Scan(&item.Payload)
+	if err != nil {
+		_ = h.Release() //nolint:errcheck
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// Item is a claimed queue item.
+type Item struct {
+	ID      int64
+	Payload []byte
+	q       *Queue
+	handle  *mysqllocker.Handle
+}
+
+// Lost returns a channel that is closed when the claim ends. Work on the item should stop when it is closed before
+// Complete or Release was called because another worker may claim the item.
+func (i *Item) Lost() <-chan struct{} {
+	return i.handle.Done()
+}
+
+// Complete marks the item done so it won't be claimed again and releases the claim. It returns an error without
+// marking the item when the claim has been lost.
+func (i *Item) Complete(ctx context.Context) error {
+	err := i.handle.Touch(ctx)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE %s SET done_at = NOW(6) WHERE id = ?`, i.q.table)
+	_, err = i.q.db.ExecContext(ctx, query, i.ID)
+	if err != nil {
+		return err
+	}
+	return i.handle.Release()
+}
+
+// Release gives the item back to the queue without completing it.
+func (i *Item) Release() error {
+	return i.handle.Release()
+}
+
+// SchemaSQL returns the CREATE TABLE statement for the queue's table with tableOptions, such as
+// "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", after it. It is for teams that manage DDL through their own migrations
+// instead of EnsureSchema.
+func (q *Queue) SchemaSQL(tableOptions string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  payload BLOB NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  done_at DATETIME(6) NULL,
+  KEY done_at_id (done_at, id)
+) %s`, q.table, tableOptions)
+}
+
+// EnsureSchema creates the queue's table with the statement from SchemaSQL and mysqllocker.DefaultTableOptions
+// if it doesn't exist.
+func (q *Queue) EnsureSchema(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, q.SchemaSQL(mysqllocker.DefaultTableOptions))
+	return err
+}
@@ -0,0 +1,98 @@
+package workqueue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/mysqllocker/internal/testdb"
+)
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.work_queue_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	q := New(db, table, WithBatchSize(1))
+	require.NoError(t, q.EnsureSchema(ctx))
+	require.NoError(t, q.EnsureSchema(ctx))
+
+	_, err = q.Claim(ctx)
+	require.Equal(t, ErrEmpty, err)
+	first, err := q.Add(ctx, []byte("first"))
+	require.NoError(t, err)
+	second, err := q.Add(ctx, []byte("second"))
+	require.NoError(t, err)
+
+	item1, err := q.Claim(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, item1.ID)
+	require.Equal(t, "first", string(item1.Payload))
+	item2, err := q.Claim(ctx)
+	require.NoError(t, err)
+	require.Equal(t, second, item2.ID)
+	_, err = q.Claim(ctx)
+	require.Equal(t, ErrEmpty, err)
+
+	// a released item goes back to the queue
+	require.NoError(t, item1.Release())
+	item1, err = q.Claim(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, item1.ID)
+
+	// a completed item doesn't
+	require.NoError(t, item1.Complete(ctx))
+	require.NoError(t, item2.Release())
+	item2, err = q.Claim(ctx)
+	require.NoError(t, err)
+	require.Equal(t, second, item2.ID)
+	require.NoError(t, item2.Complete(ctx))
+	_, err = q.Claim(ctx)
+	require.Equal(t, ErrEmpty, err)
+}
+
+func TestClaimDeadline(t *testing.T) {
+	t.Parallel()
+	db := testdb.DB(t)
+	ctx := context.Background()
+	table := "mysqllocker_test.work_queue_" + fmt.Sprint(rand.Int63())
+	_, err := db.ExecContext(ctx, `CREATE DATABASE IF NOT EXISTS mysqllocker_test`)
+	require.NoError(t, err)
+	q := New(db, table, WithBatchSize(1))
+	require.NoError(t, q.EnsureSchema(ctx))
+	first, err := q.Add(ctx, []byte("first"))
+	require.NoError(t, err)
+	second, err := q.Add(ctx, []byte("second"))
+	require.NoError(t, err)
+	item1, err := q.Claim(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, item1.ID)
+
+	// a deadline doesn't make Claim wait on the claimed item
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	start := time.Now()
+	item2, err := q.Claim(deadlineCtx)
+	require.NoError(t, err)
+	require.Equal(t, second, item2.ID)
+	require.Less(t, time.Since(start), 10*time.Second)
+	require.NoError(t, item1.Release())
+	require.NoError(t, item2.Release())
+}
+
+func TestClaimError(t *testing.T) {
+	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:1)/")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	q := New(db, "mysqllocker_test.work_queue")
+	// an error other than contention isn't mistaken for another worker having the item
+	item, err := q.claim(context.Background(), 1)
+	require.Error(t, err)
+	require.Nil(t, item)
+}